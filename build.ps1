@@ -1,2 +1,8 @@
-go build -o dist/task-scheduler.exe
-Write-Host "Build compiled successfully to dist/"
\ No newline at end of file
+# Stamp the binary with where it was built from so --version can report it
+$version = git describe --tags --always --dirty 2>$null
+if (-not $version) { $version = "dev" }
+$commit = git rev-parse --short HEAD 2>$null
+if (-not $commit) { $commit = "unknown" }
+$date = (Get-Date).ToUniversalTime().ToString("yyyy-MM-ddTHH:mm:ssZ")
+go build -ldflags "-X main.version=$version -X main.commit=$commit -X main.date=$date" -o dist/task-scheduler.exe
+Write-Host "Build compiled successfully to dist/"
@@ -0,0 +1,462 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jt28828/go-shedule-tasks/scheduler"
+)
+
+// The layout of a config file. Tasks can also be given as a list at the top level of the file
+type configFile struct {
+	Tasks []json.RawMessage `json:"tasks"`
+	// Shared settings tasks can inherit with task_group, by group name. Already merged into the tasks by the time the
+	// file is decoded into this struct
+	TaskGroups map[string]json.RawMessage `json:"task_groups"`
+}
+
+// A single task in a config file.
+// Config files are decoded into generic values first, then re-encoded as JSON so they can be mapped onto this struct
+type taskConfig struct {
+	Name    string `json:"name"`
+	Command string `json:"command"`
+	// The task group to take the settings the task doesn't set itself from. Merged in before the task is decoded
+	TaskGroup string `json:"task_group"`
+	// Durations can be written several ways so they're parsed by parseConfigDuration
+	Interval    json.RawMessage        `json:"interval"`
+	Cron        string                 `json:"cron"`
+	At          string                 `json:"at"`
+	Env         map[string]interface{} `json:"env"`
+	Cwd         string                 `json:"cwd"`
+	User        string                 `json:"user"`
+	Group       string                 `json:"group"`
+	Nice        int                    `json:"nice"`
+	IONice      string                 `json:"ionice"`
+	After       string                 `json:"after"`
+	Timeout     json.RawMessage        `json:"timeout"`
+	Retries     int                    `json:"retries"`
+	MaxRuns     int                    `json:"max_runs"`
+	MaxFailures int                    `json:"max_failures"`
+	RetryDelay  json.RawMessage        `json:"retry_delay"`
+	// The exit codes a failed run is retried on, empty to retry any failure
+	RetryOnCodes []int           `json:"retry_on_codes"`
+	Jitter       json.RawMessage `json:"jitter"`
+	RetryJitter  json.RawMessage `json:"retry_jitter"`
+	Offset       json.RawMessage `json:"offset"`
+	// How many runs in a row need to fail before the interval backs off, and the longest it can back off to
+	BackoffAfter int             `json:"backoff_after"`
+	BackoffMax   json.RawMessage `json:"backoff_max"`
+	Overlap      string          `json:"overlap"`
+	Verbosity    string          `json:"verbosity"`
+	// Whether the command is an HTTP request to send, and the basic auth to send with it
+	HTTP          bool   `json:"http"`
+	HTTPBasicAuth string `json:"http_basic_auth"`
+	// A dotenv file of more env vars for the task
+	EnvFile string `json:"env_file"`
+	// What to give the task on stdin, or @ followed by a file to read it from
+	Stdin string `json:"stdin"`
+	// A command that has to succeed before each run for the run to go ahead
+	Guard string `json:"guard"`
+	// Labels for the task's metrics and the HTTP API, e.g. {"team": "infra"}
+	Labels map[string]interface{} `json:"labels"`
+	// A URL to ping after every successful run, and whether to also ping it when runs start and fail
+	PingURL          string `json:"ping_url"`
+	PingStartAndFail bool   `json:"ping_start_and_fail"`
+	// Which waiting task goes first under --serial or --max-concurrent, highest first
+	Priority int `json:"priority"`
+	// A file to write the task's stdout to and whether each run truncates or appends to it
+	OutputFile     string `json:"output_file"`
+	OutputFileMode string `json:"output_file_mode"`
+	Enabled        *bool  `json:"enabled"`
+}
+
+// The units that can be used when a duration is written as an object (e.g. {"hours": 1, "minutes": 30})
+var configDurationUnits = map[string]time.Duration{
+	"weeks":        7 * 24 * time.Hour,
+	"days":         24 * time.Hour,
+	"hours":        time.Hour,
+	"minutes":      time.Minute,
+	"seconds":      time.Second,
+	"milliseconds": time.Millisecond,
+}
+
+// Loads a YAML or JSON config file and returns the tasks defined in it, including any that are disabled. Files ending
+// in .json are read as JSON, anything else as YAML
+func loadConfigFile(configPath string) ([]scheduler.Task, error) {
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open config file at %s: %v", configPath, err)
+	}
+
+	var document interface{}
+	if strings.EqualFold(filepath.Ext(configPath), ".json") {
+		document, err = parseJSONConfig(data)
+	} else {
+		document, err = parseYAML(string(data))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file %s: %v", configPath, err)
+	}
+	// Allow the tasks to be given as a list without the "tasks:" key
+	if taskList, isList := document.([]interface{}); isList {
+		document = map[string]interface{}{"tasks": taskList}
+	}
+	if err := applyTaskGroups(document); err != nil {
+		return nil, fmt.Errorf("config file %s: %v", configPath, err)
+	}
+
+	encoded, err := json.Marshal(document)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file %s: %v", configPath, err)
+	}
+
+	var config configFile
+	if err := json.Unmarshal(encoded, &config); err != nil {
+		return nil, fmt.Errorf("config file %s should contain a list of tasks under a \"tasks\" key", configPath)
+	}
+
+	var configTasks []scheduler.Task
+	for i, rawTask := range config.Tasks {
+		task, err := parseTaskConfig(rawTask)
+		if err != nil {
+			return nil, fmt.Errorf("config file %s: %s: %v", configPath, describeConfigTask(i, rawTask), err)
+		}
+		configTasks = append(configTasks, *task)
+	}
+	return configTasks, nil
+}
+
+// Fills in the settings of every task that uses a task group with the group's settings, where the task doesn't set
+// them itself. Env vars and labels are merged one by one, so a task can add to or override a group's. Works on the
+// generic values the file was parsed into so a setting given by the task always wins however it was written
+func applyTaskGroups(document interface{}) error {
+	fields, isObject := document.(map[string]interface{})
+	if !isObject {
+		// Not a valid config, which decoding reports
+		return nil
+	}
+	groups, _ := fields["task_groups"].(map[string]interface{})
+	if rawGroups, hasGroups := fields["task_groups"]; hasGroups && rawGroups != nil && groups == nil {
+		return fmt.Errorf("task_groups should be a set of group names and their settings")
+	}
+	for groupName, group := range groups {
+		groupSettings, isObject := group.(map[string]interface{})
+		if !isObject {
+			return fmt.Errorf("task group %s should be a set of task settings", groupName)
+		}
+		for _, field := range []string{"name", "command", "task_group"} {
+			if _, hasField := groupSettings[field]; hasField {
+				return fmt.Errorf("task group %s can't set %s, it can only be set by each task", groupName, field)
+			}
+		}
+	}
+
+	tasks, _ := fields["tasks"].([]interface{})
+	for i, task := range tasks {
+		taskSettings, isObject := task.(map[string]interface{})
+		if !isObject || taskSettings["task_group"] == nil {
+			continue
+		}
+		taskLabel := fmt.Sprintf("task %d", i+1)
+		if name, named := taskSettings["name"]; named {
+			taskLabel += fmt.Sprintf(" (%v)", name)
+		}
+		groupName, isString := taskSettings["task_group"].(string)
+		if !isString {
+			return fmt.Errorf("%s: the task_group field should be the name of a group", taskLabel)
+		}
+		groupSettings, exists := groups[groupName].(map[string]interface{})
+		if !exists {
+			return fmt.Errorf("%s: the task group %s isn't defined under task_groups", taskLabel, groupName)
+		}
+
+		for field, value := range groupSettings {
+			if _, setByTask := taskSettings[field]; !setByTask {
+				taskSettings[field] = value
+				continue
+			}
+			groupEnv, groupHasEnv := value.(map[string]interface{})
+			taskEnv, taskHasEnv := taskSettings[field].(map[string]interface{})
+			if (field == "env" || field == "labels") && groupHasEnv && taskHasEnv {
+				merged := map[string]interface{}{}
+				for key, envValue := range groupEnv {
+					merged[key] = envValue
+				}
+				for key, envValue := range taskEnv {
+					merged[key] = envValue
+				}
+				taskSettings[field] = merged
+			}
+		}
+	}
+	return nil
+}
+
+// Decodes a JSON config file into generic values, the same shape parseYAML gives
+func parseJSONConfig(data []byte) (interface{}, error) {
+	var document interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	// Keep numbers as they were written, the same as the YAML parser does
+	decoder.UseNumber()
+	if err := decoder.Decode(&document); err != nil {
+		var syntaxErr *json.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			line := bytes.Count(data[:syntaxErr.Offset], []byte("\n")) + 1
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		return nil, err
+	}
+	if decoder.More() {
+		return nil, fmt.Errorf("there's more after the end of the JSON document")
+	}
+	return document, nil
+}
+
+// Describes a task by its position in the config file and its name (if it has one) for error messages
+func describeConfigTask(index int, rawTask json.RawMessage) string {
+	var named struct {
+		Name interface{} `json:"name"`
+	}
+	if json.Unmarshal(rawTask, &named) == nil && named.Name != nil {
+		return fmt.Sprintf("task %d (%v)", index+1, named.Name)
+	}
+	return fmt.Sprintf("task %d", index+1)
+}
+
+// Validates a single task from a config file and converts it into a Task. Disabled tasks are still validated so
+// they're ready to be turned back on
+func parseTaskConfig(rawTask json.RawMessage) (*scheduler.Task, error) {
+	var config taskConfig
+	// Keep numbers as they were written so env values like 1000000 don't become 1e+06
+	decoder := json.NewDecoder(bytes.NewReader(rawTask))
+	decoder.UseNumber()
+	if err := decoder.Decode(&config); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			return nil, fmt.Errorf("the %s field should be of type %v, not %s", typeErr.Field, typeErr.Type, typeErr.Value)
+		}
+		return nil, fmt.Errorf("should be a set of task fields: %v", err)
+	}
+
+	command := strings.TrimSpace(config.Command)
+	if command == "" {
+		return nil, fmt.Errorf("the command field is required")
+	}
+
+	task := &scheduler.Task{
+		Command:      command,
+		Name:         config.Name,
+		WorkingDir:   config.Cwd,
+		User:         config.User,
+		Group:        config.Group,
+		Nice:         config.Nice,
+		IONice:       config.IONice,
+		EnvFile:      config.EnvFile,
+		HTTP:         config.HTTP,
+		OutputFile:   config.OutputFile,
+		After:        config.After,
+		Guard:        config.Guard,
+		Stdin:        config.Stdin,
+		PingURL:      config.PingURL,
+		Retries:      config.Retries,
+		RetryOnCodes: config.RetryOnCodes,
+		MaxRuns:      config.MaxRuns,
+		MaxFailures:  config.MaxFailures,
+		BackoffAfter: config.BackoffAfter,
+		Disabled:     config.Enabled != nil && !*config.Enabled,
+	}
+	task.PingStartAndFail = config.PingStartAndFail
+	task.Priority = config.Priority
+
+	interval, hasInterval, err := parseConfigDuration(config.Interval)
+	if err != nil {
+		return nil, fmt.Errorf("invalid interval %s: %v", config.Interval, err)
+	}
+
+	scheduleCount := 0
+	for _, hasSchedule := range []bool{hasInterval, config.Cron != "", config.At != ""} {
+		if hasSchedule {
+			scheduleCount++
+		}
+	}
+
+	switch {
+	case scheduleCount > 1:
+		return nil, fmt.Errorf("only one of interval, cron or at can be given")
+	case hasInterval:
+		task.Interval = interval
+	case config.Cron != "":
+		if err := scheduler.ValidateCron(config.Cron); err != nil {
+			return nil, fmt.Errorf("invalid cron \"%s\": %v", config.Cron, err)
+		}
+		task.Cron = config.Cron
+	case config.At != "":
+		runAt, err := parseAtTime(config.At, time.Now().In(timezone))
+		if err != nil {
+			return nil, err
+		}
+		task.At = runAt
+	default:
+		return nil, fmt.Errorf("one of an interval, a cron expression or an at time is required")
+	}
+
+	if task.Timeout, _, err = parseConfigDuration(config.Timeout); err != nil {
+		return nil, fmt.Errorf("invalid timeout %s: %v", config.Timeout, err)
+	}
+	if task.RetryDelay, _, err = parseConfigDuration(config.RetryDelay); err != nil {
+		return nil, fmt.Errorf("invalid retry_delay %s: %v", config.RetryDelay, err)
+	}
+	if task.Jitter, _, err = parseConfigDuration(config.Jitter); err != nil {
+		return nil, fmt.Errorf("invalid jitter %s: %v", config.Jitter, err)
+	}
+	if task.RetryJitter, _, err = parseConfigDuration(config.RetryJitter); err != nil {
+		return nil, fmt.Errorf("invalid retry_jitter %s: %v", config.RetryJitter, err)
+	}
+	if task.Offset, _, err = parseConfigDuration(config.Offset); err != nil {
+		return nil, fmt.Errorf("invalid offset %s: %v", config.Offset, err)
+	}
+	if task.BackoffMax, _, err = parseConfigDuration(config.BackoffMax); err != nil {
+		return nil, fmt.Errorf("invalid backoff_max %s: %v", config.BackoffMax, err)
+	}
+	if config.Overlap != "" {
+		if err := scheduler.ValidateOverlapMode(config.Overlap); err != nil {
+			return nil, err
+		}
+		task.Overlap = config.Overlap
+	}
+	if config.HTTPBasicAuth != "" {
+		if !config.HTTP {
+			return nil, fmt.Errorf("http_basic_auth can only be used with http tasks")
+		}
+		if !strings.Contains(config.HTTPBasicAuth, ":") {
+			return nil, fmt.Errorf("http_basic_auth should be user:password")
+		}
+		task.HTTPBasicAuth = config.HTTPBasicAuth
+	}
+	if config.OutputFileMode != "" {
+		if err := scheduler.ValidateOutputFileMode(config.OutputFileMode); err != nil {
+			return nil, err
+		}
+		task.OutputFileMode = config.OutputFileMode
+	}
+	if config.Verbosity != "" {
+		if err := scheduler.ValidateVerbosity(config.Verbosity); err != nil {
+			return nil, err
+		}
+		task.Verbosity = config.Verbosity
+	}
+	if config.Retries < 0 {
+		return nil, fmt.Errorf("retries can't be negative")
+	}
+	for _, code := range config.RetryOnCodes {
+		if code < 0 {
+			return nil, fmt.Errorf("retry_on_codes can't have negative exit codes")
+		}
+	}
+	if config.MaxRuns < 0 {
+		return nil, fmt.Errorf("max_runs can't be negative")
+	}
+	if config.MaxFailures < 0 {
+		return nil, fmt.Errorf("max_failures can't be negative")
+	}
+	if config.BackoffAfter < 0 || task.BackoffMax < 0 {
+		return nil, fmt.Errorf("backoff_after and backoff_max can't be negative")
+	}
+
+	// Sort the env vars so tasks always get them in the same order
+	envKeys := make([]string, 0, len(config.Env))
+	for key := range config.Env {
+		envKeys = append(envKeys, key)
+	}
+	sort.Strings(envKeys)
+	for _, key := range envKeys {
+		if !isValidEnvKey(key) {
+			return nil, fmt.Errorf("\"%s\" isn't a valid env var name, only letters, numbers and underscores can be used", key)
+		}
+		switch value := config.Env[key].(type) {
+		case string, bool, json.Number:
+			task.Env = append(task.Env, fmt.Sprintf("%s=%v", key, value))
+		case nil:
+			task.Env = append(task.Env, key+"=")
+		default:
+			return nil, fmt.Errorf("the env var %s should be a single value", key)
+		}
+	}
+	for name, value := range config.Labels {
+		if err := scheduler.ValidateLabelName(name); err != nil {
+			return nil, err
+		}
+		if task.Labels == nil {
+			task.Labels = map[string]string{}
+		}
+		switch value := value.(type) {
+		case string, bool, json.Number:
+			task.Labels[name] = fmt.Sprint(value)
+		case nil:
+			task.Labels[name] = ""
+		default:
+			return nil, fmt.Errorf("the label %s should be a single value", name)
+		}
+	}
+
+	return task, nil
+}
+
+// Parses a duration from a config file, returning whether one was given.
+// Durations can be a duration string ("1h30m"), a number of seconds (90) or an object of units ({"minutes": 90})
+func parseConfigDuration(raw json.RawMessage) (time.Duration, bool, error) {
+	var value interface{}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	if len(raw) == 0 || decoder.Decode(&value) != nil || value == nil {
+		return 0, false, nil
+	}
+
+	switch value := value.(type) {
+	case string:
+		if value == "" {
+			return 0, false, nil
+		}
+		duration, err := parseDuration(value)
+		return duration, true, err
+	case json.Number:
+		seconds, err := value.Float64()
+		if err != nil {
+			return 0, true, err
+		}
+		if seconds < 0 {
+			return 0, true, fmt.Errorf("durations can't be negative")
+		}
+		return time.Duration(seconds * float64(time.Second)), true, nil
+	case map[string]interface{}:
+		var duration time.Duration
+		for unit, amount := range value {
+			unitLength, isUnit := configDurationUnits[unit]
+			if !isUnit {
+				return 0, true, fmt.Errorf("unknown unit \"%s\", expected weeks, days, hours, minutes, seconds or milliseconds", unit)
+			}
+			number, isNumber := amount.(json.Number)
+			if !isNumber {
+				return 0, true, fmt.Errorf("the %s should be a number", unit)
+			}
+			count, err := number.Float64()
+			if err != nil {
+				return 0, true, err
+			}
+			if count < 0 {
+				return 0, true, fmt.Errorf("durations can't be negative")
+			}
+			duration += time.Duration(count * float64(unitLength))
+		}
+		return duration, true, nil
+	default:
+		return 0, true, fmt.Errorf("should be a duration string (e.g. \"1h30m\"), a number of seconds or an object of units (e.g. {\"hours\": 1})")
+	}
+}
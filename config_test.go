@@ -0,0 +1,291 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Writes a config file with the given name and content to a temp dir, returning its path
+func writeConfigFile(t *testing.T, name string, content string) string {
+	t.Helper()
+	configPath := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(configPath, []byte(content), 0o644); err != nil {
+		t.Fatalf("can't write the config file: %v", err)
+	}
+	return configPath
+}
+
+func TestParseConfigDuration(t *testing.T) {
+	tests := []struct {
+		raw      string
+		duration time.Duration
+		given    bool
+	}{
+		{`"1h30m"`, 90 * time.Minute, true},
+		{`"2d"`, 48 * time.Hour, true},
+		{`90`, 90 * time.Second, true},
+		{`1.5`, 1500 * time.Millisecond, true},
+		{`{"hours": 1, "minutes": 30}`, 90 * time.Minute, true},
+		{`{"weeks": 1, "milliseconds": 500}`, 7*24*time.Hour + 500*time.Millisecond, true},
+		{`{}`, 0, true},
+		// Not given at all
+		{``, 0, false},
+		{`null`, 0, false},
+		{`""`, 0, false},
+	}
+	for _, test := range tests {
+		duration, given, err := parseConfigDuration(json.RawMessage(test.raw))
+		if err != nil {
+			t.Errorf("parseConfigDuration(%s) failed: %v", test.raw, err)
+			continue
+		}
+		if duration != test.duration || given != test.given {
+			t.Errorf("parseConfigDuration(%s) = %v %v, expected %v %v", test.raw, duration, given, test.duration, test.given)
+		}
+	}
+
+	for _, raw := range []string{`"soon"`, `-5`, `{"fortnights": 1}`, `{"hours": "1"}`, `{"minutes": -1}`, `true`, `["1h"]`} {
+		if duration, _, err := parseConfigDuration(json.RawMessage(raw)); err == nil {
+			t.Errorf("parseConfigDuration(%s) = %v, expected an error", raw, duration)
+		}
+	}
+}
+
+func TestDescribeConfigTask(t *testing.T) {
+	tests := []struct {
+		index    int
+		rawTask  string
+		expected string
+	}{
+		{0, `{"name": "backup", "command": "./backup.sh"}`, "task 1 (backup)"},
+		{2, `{"command": "./backup.sh"}`, "task 3"},
+		{1, `{"name": 5}`, "task 2 (5)"},
+		// Not a task at all, so there's no name to give
+		{3, `"./backup.sh"`, "task 4"},
+	}
+	for _, test := range tests {
+		if described := describeConfigTask(test.index, json.RawMessage(test.rawTask)); described != test.expected {
+			t.Errorf("describeConfigTask(%d, %s) = %q, expected %q", test.index, test.rawTask, described, test.expected)
+		}
+	}
+}
+
+func TestLoadJSONConfigFile(t *testing.T) {
+	t.Run("reads string and structured intervals", func(t *testing.T) {
+		configPath := writeConfigFile(t, "tasks.json", `{
+  "tasks": [
+    {"name": "backup", "command": "./backup.sh", "interval": "1h30m"},
+    {"name": "report", "command": "./report.sh", "interval": {"days": 1, "hours": 2}},
+    {"command": "./sync.sh", "interval": 45}
+  ]
+}`)
+		tasks, err := loadConfigFile(configPath)
+		if err != nil {
+			t.Fatalf("loadConfigFile failed: %v", err)
+		}
+
+		expected := []struct {
+			command  string
+			interval time.Duration
+		}{
+			{"./backup.sh", 90 * time.Minute},
+			{"./report.sh", 26 * time.Hour},
+			{"./sync.sh", 45 * time.Second},
+		}
+		if len(tasks) != len(expected) {
+			t.Fatalf("expected %d tasks, got %d", len(expected), len(tasks))
+		}
+		for i, want := range expected {
+			if tasks[i].Command != want.command || tasks[i].Interval != want.interval {
+				t.Errorf("task %d is %s every %v, expected %s every %v", i, tasks[i].Command, tasks[i].Interval, want.command, want.interval)
+			}
+		}
+	})
+
+	t.Run("reads a top level list of tasks", func(t *testing.T) {
+		configPath := writeConfigFile(t, "tasks.json", `[{"command": "./backup.sh", "interval": "5m"}]`)
+		tasks, err := loadConfigFile(configPath)
+		if err != nil {
+			t.Fatalf("loadConfigFile failed: %v", err)
+		}
+		if len(tasks) != 1 || tasks[0].Interval != 5*time.Minute {
+			t.Errorf("expected a single task every 5m, got %+v", tasks)
+		}
+	})
+
+	t.Run("names the failing task", func(t *testing.T) {
+		tests := []struct {
+			name      string
+			content   string
+			errorText string
+		}{
+			{
+				"bad string interval",
+				`{"tasks": [{"command": "./backup.sh", "interval": "1h"}, {"name": "report", "command": "./report.sh", "interval": "soon"}]}`,
+				"task 2 (report): invalid interval",
+			},
+			{
+				"bad structured interval",
+				`{"tasks": [{"command": "./a.sh", "interval": "1h"}, {"command": "./b.sh", "interval": "1h"}, {"command": "./c.sh", "interval": {"fortnights": 1}}]}`,
+				"task 3: invalid interval",
+			},
+			{
+				"missing command",
+				`{"tasks": [{"name": "nothing", "interval": "1h"}]}`,
+				"task 1 (nothing): the command field is required",
+			},
+		}
+		for _, test := range tests {
+			_, err := loadConfigFile(writeConfigFile(t, "tasks.json", test.content))
+			if err == nil {
+				t.Errorf("%s: expected an error", test.name)
+				continue
+			}
+			if !strings.Contains(err.Error(), test.errorText) {
+				t.Errorf("%s: failed with %q, expected it to contain %q", test.name, err, test.errorText)
+			}
+		}
+	})
+
+	t.Run("gives the line of a syntax error", func(t *testing.T) {
+		_, err := loadConfigFile(writeConfigFile(t, "tasks.json", "{\n  \"tasks\": [\n    {\"command\": \"./backup.sh\",}\n  ]\n}"))
+		if err == nil || !strings.Contains(err.Error(), "line 3") {
+			t.Errorf("expected an error naming line 3, got %v", err)
+		}
+	})
+}
+
+func TestApplyTaskGroups(t *testing.T) {
+	group := map[string]interface{}{
+		"interval": "1h",
+		"retries":  int64(3),
+		"env":      map[string]interface{}{"REGION": "eu", "LEVEL": "info"},
+		"labels":   map[string]interface{}{"team": "infra"},
+	}
+	tests := []struct {
+		name     string
+		task     map[string]interface{}
+		expected map[string]interface{}
+	}{
+		{
+			"takes every setting from the group",
+			map[string]interface{}{"command": "./backup.sh", "task_group": "nightly"},
+			map[string]interface{}{
+				"command":    "./backup.sh",
+				"task_group": "nightly",
+				"interval":   "1h",
+				"retries":    int64(3),
+				"env":        map[string]interface{}{"REGION": "eu", "LEVEL": "info"},
+				"labels":     map[string]interface{}{"team": "infra"},
+			},
+		},
+		{
+			"keeps the fields the task sets",
+			map[string]interface{}{"command": "./backup.sh", "task_group": "nightly", "interval": "5m", "retries": int64(0)},
+			map[string]interface{}{
+				"command":    "./backup.sh",
+				"task_group": "nightly",
+				"interval":   "5m",
+				"retries":    int64(0),
+				"env":        map[string]interface{}{"REGION": "eu", "LEVEL": "info"},
+				"labels":     map[string]interface{}{"team": "infra"},
+			},
+		},
+		{
+			"merges env and labels one by one",
+			map[string]interface{}{
+				"command":    "./backup.sh",
+				"task_group": "nightly",
+				"env":        map[string]interface{}{"LEVEL": "debug", "TARGET": "s3"},
+				"labels":     map[string]interface{}{"env": "prod"},
+			},
+			map[string]interface{}{
+				"command":    "./backup.sh",
+				"task_group": "nightly",
+				"interval":   "1h",
+				"retries":    int64(3),
+				"env":        map[string]interface{}{"REGION": "eu", "LEVEL": "debug", "TARGET": "s3"},
+				"labels":     map[string]interface{}{"team": "infra", "env": "prod"},
+			},
+		},
+		{
+			"leaves tasks without a group alone",
+			map[string]interface{}{"command": "./report.sh", "interval": "2h"},
+			map[string]interface{}{"command": "./report.sh", "interval": "2h"},
+		},
+	}
+	for _, test := range tests {
+		document := map[string]interface{}{
+			"task_groups": map[string]interface{}{"nightly": group},
+			"tasks":       []interface{}{test.task},
+		}
+		if err := applyTaskGroups(document); err != nil {
+			t.Errorf("%s: applyTaskGroups failed: %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(test.task, test.expected) {
+			t.Errorf("%s: the task became %v, expected %v", test.name, test.task, test.expected)
+		}
+	}
+	if group["env"].(map[string]interface{})["LEVEL"] != "info" {
+		t.Errorf("merging a task's env changed the group's, which is shared by every task in it")
+	}
+}
+
+func TestApplyTaskGroupsRejectsBadGroups(t *testing.T) {
+	tests := []struct {
+		name      string
+		document  map[string]interface{}
+		errorText string
+	}{
+		{
+			"undefined group",
+			map[string]interface{}{
+				"task_groups": map[string]interface{}{"nightly": map[string]interface{}{"interval": "1h"}},
+				"tasks": []interface{}{
+					map[string]interface{}{"command": "./backup.sh", "task_group": "nightly"},
+					map[string]interface{}{"name": "report", "command": "./report.sh", "task_group": "weekly"},
+				},
+			},
+			"task 2 (report): the task group weekly isn't defined under task_groups",
+		},
+		{
+			"no groups at all",
+			map[string]interface{}{"tasks": []interface{}{map[string]interface{}{"command": "./backup.sh", "task_group": "nightly"}}},
+			"task 1: the task group nightly isn't defined under task_groups",
+		},
+		{
+			"group setting a task's own field",
+			map[string]interface{}{"task_groups": map[string]interface{}{"nightly": map[string]interface{}{"command": "./backup.sh"}}},
+			"task group nightly can't set command",
+		},
+		{
+			"group that isn't a set of settings",
+			map[string]interface{}{"task_groups": map[string]interface{}{"nightly": "1h"}},
+			"task group nightly should be a set of task settings",
+		},
+		{
+			"task_group that isn't a name",
+			map[string]interface{}{
+				"task_groups": map[string]interface{}{"nightly": map[string]interface{}{"interval": "1h"}},
+				"tasks":       []interface{}{map[string]interface{}{"command": "./backup.sh", "task_group": int64(1)}},
+			},
+			"task 1: the task_group field should be the name of a group",
+		},
+	}
+	for _, test := range tests {
+		err := applyTaskGroups(test.document)
+		if err == nil {
+			t.Errorf("%s: expected an error", test.name)
+			continue
+		}
+		if !strings.Contains(err.Error(), test.errorText) {
+			t.Errorf("%s: failed with %q, expected it to contain %q", test.name, err, test.errorText)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/jt28828/go-shedule-tasks/scheduler"
+)
+
+// The fields of taskConfig that have to be given
+var requiredConfigFields = []string{"command"}
+
+// The values the fields of taskConfig that only take a few values can be set to
+var configFieldValues = map[string][]string{
+	"overlap":          {scheduler.OverlapWait, scheduler.OverlapQueue, scheduler.OverlapSkip},
+	"verbosity":        {scheduler.VerbosityQuiet, scheduler.VerbosityNormal, scheduler.VerbosityVerbose},
+	"output_file_mode": {scheduler.OutputFileTruncate, scheduler.OutputFileAppend},
+}
+
+// A JSON schema, kept generic as the schema for a field depends on its type
+type jsonSchema map[string]interface{}
+
+// Builds the JSON schema of a config file from taskConfig, so its fields always match what loadConfigFile reads. A
+// config file is either a list of tasks or an object with a list of tasks in its tasks field. Unknown fields are
+// ignored by the loader but not allowed by the schema, so editors can point out typos
+func configFileSchema() (jsonSchema, error) {
+	taskSchema, err := taskConfigSchema()
+	if err != nil {
+		return nil, err
+	}
+	taskList := jsonSchema{"type": "array", "items": jsonSchema{"$ref": "#/$defs/task"}}
+	// A group can set anything a task can, apart from what has to be set by each task
+	groupProperties := jsonSchema{}
+	for name, fieldSchema := range taskSchema["properties"].(jsonSchema) {
+		if name != "name" && name != "command" && name != "task_group" {
+			groupProperties[name] = fieldSchema
+		}
+	}
+	groupSchema := jsonSchema{"type": "object", "properties": groupProperties, "additionalProperties": false}
+	return jsonSchema{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"title":   "task-scheduler config",
+		"oneOf": []jsonSchema{
+			taskList,
+			{
+				"type": "object",
+				"properties": jsonSchema{
+					"tasks":       taskList,
+					"task_groups": jsonSchema{"type": "object", "additionalProperties": groupSchema},
+				},
+				"required":             []string{"tasks"},
+				"additionalProperties": false,
+			},
+		},
+		"$defs": jsonSchema{"task": taskSchema},
+	}, nil
+}
+
+// Builds the schema of a single task from the fields of taskConfig and their json tags
+func taskConfigSchema() (jsonSchema, error) {
+	properties := jsonSchema{}
+	configType := reflect.TypeOf(taskConfig{})
+	for i := 0; i < configType.NumField(); i++ {
+		field := configType.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		fieldSchema, err := configFieldSchema(field.Type)
+		if err != nil {
+			return nil, fmt.Errorf("can't describe the %s config field. %v", name, err)
+		}
+		if values, hasValues := configFieldValues[name]; hasValues {
+			fieldSchema["enum"] = values
+		}
+		properties[name] = fieldSchema
+	}
+
+	return jsonSchema{
+		"type":                 "object",
+		"properties":           properties,
+		"required":             requiredConfigFields,
+		"additionalProperties": false,
+	}, nil
+}
+
+// Describes the values a config field of the given type can hold
+func configFieldSchema(fieldType reflect.Type) (jsonSchema, error) {
+	if fieldType == reflect.TypeOf(json.RawMessage{}) {
+		// Every raw field is a duration, which parseConfigDuration reads
+		return durationSchema(), nil
+	}
+
+	switch fieldType.Kind() {
+	case reflect.Pointer:
+		// Pointers are only used to tell a field that's left out from its zero value
+		return configFieldSchema(fieldType.Elem())
+	case reflect.String:
+		return jsonSchema{"type": "string"}, nil
+	case reflect.Bool:
+		return jsonSchema{"type": "boolean"}, nil
+	case reflect.Int, reflect.Int64:
+		return jsonSchema{"type": "integer"}, nil
+	case reflect.Slice:
+		items, err := configFieldSchema(fieldType.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return jsonSchema{"type": "array", "items": items}, nil
+	case reflect.Map:
+		// Env vars, which can be given any single value
+		return jsonSchema{
+			"type":                 "object",
+			"additionalProperties": jsonSchema{"type": []string{"string", "number", "boolean", "null"}},
+		}, nil
+	}
+	return nil, fmt.Errorf("unsupported type %v", fieldType)
+}
+
+// The ways a duration can be written, a duration string, a number of seconds or an object of units
+func durationSchema() jsonSchema {
+	unitProperties := jsonSchema{}
+	for unit := range configDurationUnits {
+		unitProperties[unit] = jsonSchema{"type": "number"}
+	}
+
+	return jsonSchema{
+		"oneOf": []jsonSchema{
+			{"type": "string", "description": "A duration like 1h30m"},
+			{"type": "number", "description": "A number of seconds"},
+			{"type": "object", "properties": unitProperties, "additionalProperties": false},
+		},
+	}
+}
+
+// Prints the JSON schema of a config file for --config-schema
+func printConfigSchema() error {
+	schema, err := configFileSchema()
+	if err != nil {
+		return err
+	}
+	encoded, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(encoded))
+	return nil
+}
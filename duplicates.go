@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jt28828/go-shedule-tasks/scheduler"
+)
+
+// What makes two tasks duplicates of each other, running the same thing on the same schedule
+type duplicateTaskKey struct {
+	command  string
+	http     bool
+	stdin    string
+	interval time.Duration
+	cron     string
+	at       time.Time
+}
+
+// Checks no two tasks run the same command on the same schedule, which is usually a task that was copied between
+// sources and left in both. Duplicates are logged as warnings, naming where each copy came from, or returned as an
+// error when strict is set. A name given to two tasks is always an error, as names need to be unique. origins holds
+// where each task came from, by its index in tasks
+func checkDuplicateTasks(tasks []scheduler.Task, origins []string, strict bool) error {
+	// The index of the first task seen with each schedule and name
+	firstWithKey := map[duplicateTaskKey]int{}
+	firstWithName := map[string]int{}
+	for i, task := range tasks {
+		if task.Name != "" {
+			if first, seen := firstWithName[task.Name]; seen {
+				return fmt.Errorf("The task name \"%s\" was given to a task from %s and a task from %s. Every task name needs to be unique", task.Name, origins[first], origins[i])
+			}
+			firstWithName[task.Name] = i
+		}
+
+		key := duplicateTaskKey{command: task.Command, http: task.HTTP, stdin: task.Stdin, interval: task.Interval, cron: task.Cron, at: task.At.UTC()}
+		first, seen := firstWithKey[key]
+		if !seen {
+			firstWithKey[key] = i
+			continue
+		}
+		message := fmt.Sprintf("%s runs on the same schedule (%s) from both %s and %s, so it will run twice", task.Command, describeTaskSchedule(task), origins[first], origins[i])
+		if origins[first] == origins[i] {
+			message = fmt.Sprintf("%s runs on the same schedule (%s) twice in %s", task.Command, describeTaskSchedule(task), origins[i])
+		}
+		if strict {
+			return fmt.Errorf("%s. Remove one of them, or leave out --strict-duplicates to only warn about it", message)
+		}
+		scheduler.LogWarning(message)
+	}
+	return nil
+}
+
+// Describes when a task runs for the duplicate task messages
+func describeTaskSchedule(task scheduler.Task) string {
+	switch {
+	case task.Cron != "":
+		return fmt.Sprintf("cron %s", task.Cron)
+	case !task.At.IsZero():
+		return fmt.Sprintf("at %s", task.At.Format(time.RFC3339))
+	}
+	return fmt.Sprintf("every %s", scheduler.FormatDuration(task.Interval))
+}
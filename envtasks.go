@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jt28828/go-shedule-tasks/scheduler"
+)
+
+// Env vars starting with this define tasks, as TASK_<number>_<field> (e.g. TASK_1_CMD=backup.sh). Tasks are read in the
+// order of their numbers, which don't need to be consecutive
+const envTaskPrefix = "TASK_"
+
+// The fields a task can be given through env vars. CMD is required along with one of INTERVAL or CRON
+var envTaskFields = []string{"CMD", "INTERVAL", "CRON", "NAME", "TIMEOUT"}
+
+// Reads the tasks defined by TASK_<number>_<field> env vars, for containers where env vars are easier to set than
+// files. Env vars are given as KEY=VALUE like os.Environ returns them. Errors name the env var that's wrong
+func loadEnvTasks(environ []string) ([]scheduler.Task, error) {
+	// Every field given for each task, by the task's number
+	taskFields := map[int]map[string]string{}
+	for _, envVar := range environ {
+		key, value, _ := strings.Cut(envVar, "=")
+		if !strings.HasPrefix(key, envTaskPrefix) {
+			continue
+		}
+		numberText, field, hasField := strings.Cut(strings.TrimPrefix(key, envTaskPrefix), "_")
+		number, err := strconv.Atoi(numberText)
+		if err != nil || number < 0 {
+			// Something else that happens to start with TASK_
+			continue
+		}
+		if !hasField || !isEnvTaskField(field) {
+			return nil, fmt.Errorf("%s isn't a task field, expected %s%d_ followed by one of %s", key, envTaskPrefix, number, strings.Join(envTaskFields, ", "))
+		}
+		if taskFields[number] == nil {
+			taskFields[number] = map[string]string{}
+		}
+		taskFields[number][field] = value
+	}
+
+	var numbers []int
+	for number := range taskFields {
+		numbers = append(numbers, number)
+	}
+	sort.Ints(numbers)
+
+	var envTasks []scheduler.Task
+	for _, number := range numbers {
+		task, err := parseEnvTask(number, taskFields[number])
+		if err != nil {
+			return nil, err
+		}
+		envTasks = append(envTasks, task)
+	}
+	return envTasks, nil
+}
+
+// Builds a task from the fields given in its env vars
+func parseEnvTask(number int, fields map[string]string) (scheduler.Task, error) {
+	envVarName := func(field string) string {
+		return fmt.Sprintf("%s%d_%s", envTaskPrefix, number, field)
+	}
+
+	command := strings.TrimSpace(fields["CMD"])
+	if command == "" {
+		return scheduler.Task{}, fmt.Errorf("%s needs to be set for the task defined by the other %s%d_ env vars", envVarName("CMD"), envTaskPrefix, number)
+	}
+	task := scheduler.Task{Command: command, Name: fields["NAME"]}
+
+	interval, hasInterval := fields["INTERVAL"]
+	cronSpec, hasCron := fields["CRON"]
+	switch {
+	case hasInterval && hasCron:
+		return scheduler.Task{}, fmt.Errorf("only one of %s or %s can be set", envVarName("INTERVAL"), envVarName("CRON"))
+	case hasInterval:
+		duration, err := parseDuration(interval)
+		if err != nil {
+			return scheduler.Task{}, fmt.Errorf("invalid %s: %v", envVarName("INTERVAL"), err)
+		}
+		task.Interval = duration
+	case hasCron:
+		if err := scheduler.ValidateCron(cronSpec); err != nil {
+			return scheduler.Task{}, fmt.Errorf("invalid %s \"%s\": %v", envVarName("CRON"), cronSpec, err)
+		}
+		task.Cron = cronSpec
+	default:
+		return scheduler.Task{}, fmt.Errorf("%s or %s needs to be set for %s", envVarName("INTERVAL"), envVarName("CRON"), command)
+	}
+
+	if timeout, hasTimeout := fields["TIMEOUT"]; hasTimeout {
+		duration, err := parseDuration(timeout)
+		if err != nil {
+			return scheduler.Task{}, fmt.Errorf("invalid %s: %v", envVarName("TIMEOUT"), err)
+		}
+		task.Timeout = duration
+	}
+	return task, nil
+}
+
+func isEnvTaskField(field string) bool {
+	for _, envTaskField := range envTaskFields {
+		if field == envTaskField {
+			return true
+		}
+	}
+	return false
+}
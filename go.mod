@@ -0,0 +1,3 @@
+module github.com/jt28828/go-shedule-tasks
+
+go 1.22
@@ -0,0 +1,48 @@
+//go:build !windows
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/jt28828/go-shedule-tasks/scheduler"
+)
+
+// Reopens the log file and the task log files whenever the scheduler is sent SIGUSR1, so a tool like logrotate can move
+// them away and have logging carry on in new files at the same paths. Returns once ctx is done
+func watchForLogReopen(ctx context.Context) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR1)
+	defer signal.Stop(signals)
+	for {
+		select {
+		case <-signals:
+			reopenLogFiles()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Reopens every log file at its path, logging any that have to keep writing to their current file
+func reopenLogFiles() {
+	reopened := true
+	// Nil when logging to syslog, which has no file to reopen
+	if logFile != nil {
+		if err := logFile.Reopen(); err != nil {
+			scheduler.LogError(fmt.Sprintf("Failed to reopen the log file, still logging to the file that was open. %v", err))
+			reopened = false
+		}
+	}
+	if err := taskScheduler.ReopenTaskLogFiles(); err != nil {
+		scheduler.LogError(fmt.Sprintf("Failed to reopen some task log files, still logging to the files that were open. %v", err))
+		reopened = false
+	}
+	if reopened {
+		scheduler.LogInfo("Reopened the log files")
+	}
+}
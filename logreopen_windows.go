@@ -0,0 +1,8 @@
+//go:build windows
+
+package main
+
+import "context"
+
+// Windows has no SIGUSR1 to reopen the log files on, and files that are open can't be moved away anyway
+func watchForLogReopen(ctx context.Context) {}
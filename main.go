@@ -3,23 +3,82 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"log"
+	"net"
+	"net/http"
+	"net/url"
 	"os"
-	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strconv"
 	"strings"
-	"sync"
+	"syscall"
+	"text/tabwriter"
+	"text/template"
 	"time"
+
+	"github.com/jt28828/go-shedule-tasks/scheduler"
 )
 
-// The pointer to the logfile, used for cleanup after the application is closed
-var logFile *os.File
+// The pointer to the logfile, used for cleanup after the application is closed. Nil when logging to syslog
+var logFile *scheduler.RotatingLogFile
+
+// Runs every task from the flags, task file and config file
+var taskScheduler *scheduler.Scheduler
+
+// The address to serve Prometheus metrics on. Empty means no metrics server is started
+var metricsAddr string
+
+// The address to serve the HTTP control API on. Empty means no API server is started
+var httpAddr string
+
+// The address to serve the liveness and readiness probes on. Empty means no health server is started
+var healthAddr string
+
+// Whether to only check the tasks parse and print them instead of running them
+var dryRun bool
+
+// Whether to print when each task will next run and exit instead of running them
+var listTasks bool
+
+// Whether the task list is printed as JSON instead of a table. Implies listTasks
+var listTasksJSON bool
 
-// The tasks to run
-var tasks []*Task
+// Whether to run every task once and exit instead of running them on their schedules
+var runOnce bool
+
+// Where to write the scheduler's PID while it runs. Empty if it isn't written anywhere
+var pidFilePath string
+
+// How often to log that the scheduler is still running. Zero means no heartbeat is logged
+var heartbeatInterval time.Duration
+
+// How often to check the task files and config file for changes to reload. Zero means they're only reloaded on SIGHUP
+var reloadInterval time.Duration
+
+// Whether to skip checking every task's program or script can be found before starting
+var skipCommandChecks bool
+
+// The timezone cron expressions and HH:MM run once times are read in. Set with --tz, defaults to the host's local time
+var timezone = time.Local
+
+// Which build of the scheduler this is. Set when building with -ldflags "-X main.version=... -X main.commit=...
+// -X main.date=...", which the build scripts do
+var (
+	version = "dev"
+	commit  = "unknown"
+	date    = "unknown"
+)
 
-// The shell path for the local os
+// Describes which build of the scheduler is running
+func versionInfo() string {
+	return fmt.Sprintf("%s (commit %s, built %s)", version, commit, date)
+}
 
 // Allow users to input multiple copies of a single flag.
 // Implements the Var interface from flags
@@ -35,256 +94,1663 @@ func (f *stringMultiFlag) Set(flagVal string) error {
 	return nil
 }
 
-type durationMultiFlag []time.Duration
+// How often a task runs. Either a fixed duration between runs, a cron expression or a single time to run once at
+type taskSchedule struct {
+	timeBetweenRuns time.Duration
+	cronSpec        string
+	runAt           time.Time
+	// The run once time as it was given, so HH:MM times can be placed in --tz once every flag has been read
+	atText string
+	// The intervals after the first when several were given at once (e.g. "1h,5m"), each run by its own copy of the
+	// task
+	moreIntervals []time.Duration
+}
+
+// Describes the schedule the way the user entered it
+func (s taskSchedule) String() string {
+	if s.cronSpec != "" {
+		return fmt.Sprintf("\"%s\"", s.cronSpec)
+	}
+	if !s.runAt.IsZero() {
+		return s.runAt.Format(time.RFC3339)
+	}
+	intervals := []string{scheduler.FormatDuration(s.timeBetweenRuns)}
+	for _, interval := range s.moreIntervals {
+		intervals = append(intervals, scheduler.FormatDuration(interval))
+	}
+	return strings.Join(intervals, ",")
+}
 
-func (f *durationMultiFlag) String() string {
+// The schedules given by the user, in the order they were given so they can be paired with tasks.
+// Durations, cron expressions and run once times share the same list so they can be mixed in a single invocation
+type scheduleList []taskSchedule
+
+type durationMultiFlag struct {
+	schedules *scheduleList
+}
+
+func (f durationMultiFlag) String() string {
 	return "StringValue"
 }
 
-func (f *durationMultiFlag) Set(flagVal string) error {
-	// Attempt to parse the value
-	parsedVal, err := parseDurationStr(flagVal)
+// Several durations can be given at once as a comma separated list (e.g. "1h,5m") to run the task on each of them
+func (f durationMultiFlag) Set(flagVal string) error {
+	var intervals []time.Duration
+	for _, durationText := range strings.Split(flagVal, ",") {
+		// Attempt to parse the value. Flag reports the error along with the usage
+		parsedVal, err := parseDuration(strings.TrimSpace(durationText))
+		if err != nil {
+			return err
+		}
+		intervals = append(intervals, parsedVal)
+	}
+	// Append with each value that's added
+	*f.schedules = append(*f.schedules, taskSchedule{timeBetweenRuns: intervals[0], moreIntervals: intervals[1:]})
+	return nil
+}
+
+type cronMultiFlag struct {
+	schedules *scheduleList
+}
+
+func (f cronMultiFlag) String() string {
+	return "StringValue"
+}
+
+func (f cronMultiFlag) Set(flagVal string) error {
+	// Attempt to parse the value. Flag reports the error along with the usage
+	if err := scheduler.ValidateCron(flagVal); err != nil {
+		return err
+	}
+	// Append with each value that's added
+	*f.schedules = append(*f.schedules, taskSchedule{cronSpec: flagVal})
+	return nil
+}
+
+type atMultiFlag struct {
+	schedules *scheduleList
+}
+
+func (f atMultiFlag) String() string {
+	return "StringValue"
+}
+
+func (f atMultiFlag) Set(flagVal string) error {
+	// Only checks the value, --tz might come later so the time is worked out once every flag has been read
+	parsedVal, err := parseAtTime(flagVal, time.Now())
 	if err != nil {
-		// Can't continue with invalid durations
-		os.Exit(1)
+		return err
+	}
+	// Append with each value that's added
+	*f.schedules = append(*f.schedules, taskSchedule{runAt: parsedVal, atText: flagVal})
+	return nil
+}
+
+// Parses a time to run a task once at. Either a full RFC3339 timestamp or HH:MM for a time later today, in the same
+// location as now
+func parseAtTime(atText string, now time.Time) (time.Time, error) {
+	if runAt, err := time.Parse(time.RFC3339, atText); err == nil {
+		return runAt, nil
+	}
+
+	timeOfDay, err := time.Parse("15:04", atText)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("\"%s\" isn't a valid time, expected an RFC3339 timestamp (2006-01-02T15:04:05Z07:00) or HH:MM", atText)
+	}
+	return time.Date(now.Year(), now.Month(), now.Day(), timeOfDay.Hour(), timeOfDay.Minute(), 0, 0, now.Location()), nil
+}
+
+// Allow users to input multiple durations that aren't schedules (e.g. timeouts). These pair with tasks in order
+type durationValueMultiFlag []time.Duration
+
+func (f *durationValueMultiFlag) String() string {
+	return "StringValue"
+}
+
+func (f *durationValueMultiFlag) Set(flagVal string) error {
+	parsedVal, err := parseDuration(flagVal)
+	if err != nil {
+		return err
 	}
 	// Append with each value that's added
 	*f = append(*f, parsedVal)
 	return nil
 }
 
-// Defines a task struct to allow running exclusive tasks on time
-type Task struct {
-	taskText        string
-	isShellScript   bool
-	timeBetweenRuns time.Duration
-	mutex           *sync.Mutex
+// Allow users to input multiple whole numbers (e.g. retry counts). These pair with tasks in order
+type intMultiFlag []int
+
+func (f *intMultiFlag) String() string {
+	return "IntValue"
+}
+
+func (f *intMultiFlag) Set(flagVal string) error {
+	parsedVal, err := strconv.Atoi(flagVal)
+	if err != nil {
+		return err
+	}
+	if parsedVal < 0 {
+		return fmt.Errorf("%d is negative, only positive numbers are allowed", parsedVal)
+	}
+	// Append with each value that's added
+	*f = append(*f, parsedVal)
+	return nil
+}
+
+// Allow users to give nice values, which unlike other numbers can be negative
+type niceMultiFlag []int
+
+func (f *niceMultiFlag) String() string {
+	return "NiceValue"
+}
+
+func (f *niceMultiFlag) Set(flagVal string) error {
+	nice, err := strconv.Atoi(flagVal)
+	if err != nil {
+		return err
+	}
+	if nice < -20 || nice > 19 {
+		return fmt.Errorf("%d isn't a nice value, they go from -20 to 19", nice)
+	}
+	*f = append(*f, nice)
+	return nil
+}
+
+// Allow users to give task priorities, which can be negative to go behind tasks without one
+type priorityMultiFlag []int
+
+func (f *priorityMultiFlag) String() string {
+	return "PriorityValue"
+}
+
+func (f *priorityMultiFlag) Set(flagVal string) error {
+	priority, err := strconv.Atoi(flagVal)
+	if err != nil {
+		return err
+	}
+	*f = append(*f, priority)
+	return nil
+}
+
+// Allow users to give lists of exit codes as comma separated numbers (e.g. "1,75"), one list per task
+type exitCodesMultiFlag [][]int
+
+func (f *exitCodesMultiFlag) String() string {
+	return "ExitCodes"
+}
+
+func (f *exitCodesMultiFlag) Set(flagVal string) error {
+	var codes []int
+	for _, part := range strings.Split(flagVal, ",") {
+		code, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			return fmt.Errorf("%q isn't a list of exit codes like \"1,75\"", flagVal)
+		}
+		if code < 0 {
+			return fmt.Errorf("%d is negative, exit codes can't be", code)
+		}
+		codes = append(codes, code)
+	}
+	*f = append(*f, codes)
+	return nil
+}
+
+// Allow users to give labels as comma separated name=value pairs (e.g. "env=prod,team=infra"), one list per task
+type labelsMultiFlag []map[string]string
+
+func (f *labelsMultiFlag) String() string {
+	return "Labels"
+}
+
+func (f *labelsMultiFlag) Set(flagVal string) error {
+	labels := map[string]string{}
+	for _, part := range strings.Split(flagVal, ",") {
+		name, value, found := strings.Cut(strings.TrimSpace(part), "=")
+		if !found {
+			return fmt.Errorf("%q isn't a list of labels like \"env=prod,team=infra\"", flagVal)
+		}
+		if err := scheduler.ValidateLabelName(name); err != nil {
+			return err
+		}
+		labels[name] = value
+	}
+	*f = append(*f, labels)
+	return nil
+}
+
+// Allow users to give environment variables to the task declared just before them.
+// Values are stored by the index of the task they belong to
+type envMultiFlag struct {
+	taskList *stringMultiFlag
+	envs     map[int][]string
+}
+
+func (f envMultiFlag) String() string {
+	return "StringValue"
+}
+
+func (f envMultiFlag) Set(flagVal string) error {
+	if len(*f.taskList) == 0 {
+		return fmt.Errorf("an env var needs to come after the task it belongs to")
+	}
+
+	envVar, err := parseEnvVar(flagVal)
+	if err != nil {
+		return err
+	}
+	taskIndex := len(*f.taskList) - 1
+	f.envs[taskIndex] = append(f.envs[taskIndex], envVar)
+	return nil
+}
+
+// Marks the task declared before it as quiet, so only its failed runs are logged
+type quietFlag struct {
+	taskList *stringMultiFlag
+	quiet    map[int]bool
+}
+
+func (f quietFlag) String() string {
+	return "false"
+}
+
+// Lets the flag be passed without a value (-quiet) the same as a plain bool flag
+func (f quietFlag) IsBoolFlag() bool {
+	return true
+}
+
+func (f quietFlag) Set(flagVal string) error {
+	if len(*f.taskList) == 0 {
+		return fmt.Errorf("it needs to come after the task it belongs to")
+	}
+
+	quiet, err := strconv.ParseBool(flagVal)
+	if err != nil {
+		return fmt.Errorf("\"%s\" isn't true or false", flagVal)
+	}
+	f.quiet[len(*f.taskList)-1] = quiet
+	return nil
+}
+
+// Sets the prerequisite of the task declared before it, the task that has to succeed for it to run
+type afterFlag struct {
+	taskList *stringMultiFlag
+	afters   map[int]string
+}
+
+func (f afterFlag) String() string {
+	return "StringValue"
 }
 
-func init() {
+func (f afterFlag) Set(flagVal string) error {
+	if len(*f.taskList) == 0 {
+		return fmt.Errorf("it needs to come after the task it belongs to")
+	}
+	f.afters[len(*f.taskList)-1] = flagVal
+	return nil
+}
+
+// Adds a task that sends an HTTP request, given as "METHOD URL", to the same list as the other tasks so it pairs with
+// the other flags in the order given
+type httpTaskFlag struct {
+	taskList  *stringMultiFlag
+	httpTasks map[int]bool
+}
+
+func (f httpTaskFlag) String() string {
+	return "StringValue"
+}
+
+func (f httpTaskFlag) Set(flagVal string) error {
+	f.httpTasks[len(*f.taskList)] = true
+	*f.taskList = append(*f.taskList, flagVal)
+	return nil
+}
+
+// Sets the basic auth credentials of the HTTP task declared before it
+type httpAuthFlag struct {
+	taskList  *stringMultiFlag
+	httpAuths map[int]string
+}
+
+func (f httpAuthFlag) String() string {
+	return "StringValue"
+}
+
+func (f httpAuthFlag) Set(flagVal string) error {
+	if len(*f.taskList) == 0 {
+		return fmt.Errorf("it needs to come after the task it belongs to")
+	}
+	if !strings.Contains(flagVal, ":") {
+		return fmt.Errorf("expected user:password")
+	}
+	f.httpAuths[len(*f.taskList)-1] = flagVal
+	return nil
+}
+
+// Validates an environment variable in the KEY=VALUE format. A lone KEY forwards the scheduler's own value for it
+func parseEnvVar(envText string) (string, error) {
+	key, value, hasValue := strings.Cut(envText, "=")
+	if !isValidEnvKey(key) {
+		return "", fmt.Errorf("\"%s\" isn't a valid env var, expected KEY=VALUE where KEY is made of letters, numbers and underscores", envText)
+	}
+
+	if !hasValue {
+		forwardedValue, isSet := os.LookupEnv(key)
+		if !isSet {
+			return "", fmt.Errorf("can't forward the env var %s as it isn't set for the scheduler", key)
+		}
+		value = forwardedValue
+	}
+	return key + "=" + value, nil
+}
+
+// Env var names can only use letters, numbers and underscores and can't start with a number
+func isValidEnvKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	for i, char := range key {
+		isLetter := (char >= 'a' && char <= 'z') || (char >= 'A' && char <= 'Z') || char == '_'
+		isNumber := char >= '0' && char <= '9'
+		if !isLetter && !(isNumber && i > 0) {
+			return false
+		}
+	}
+	return true
+}
+
+// Reads the flags, builds every task from them and sets up logging. Called at the start of main rather than from init,
+// so tests can use the package without the test binary's flags being parsed as the scheduler's
+func setupFromFlags() {
 	// Setup user input flags
 	var taskList stringMultiFlag
-	var durationList durationMultiFlag
-	flag.Var(&taskList, "task", "A manually defined task to run. Can be a command or a path to a local script file (.sh only for now). Can be defined multiple times for many tasks")
-	flag.Var(&taskList, "t", "A manually defined task to run. Can be a command or a path to a local script file (.sh only for now). Can be defined multiple times for many tasks")
-	flag.Var(&durationList, "duration", "How often a task should run (hourly, minutely etc). Needs to be defined at least once for each task")
-	flag.Var(&durationList, "d", "How often a task should run (hourly, minutely etc). Needs to be defined at least once for each task")
-	logfilePath := flag.String("logs", "./task-scheduler.log", "Where to output application logs")
-	taskFilePath := flag.String("file", "", "The location of a predefined task file, should have one task per line in the following format: \"/etc/path/to/my/script.sh 2h5m10s\" to run the designated script / task every 2hrs 5mins and 10 seconds")
+	var schedules scheduleList
+	flag.Var(&taskList, "task", "A manually defined task to run. Can be a command or a path to a local script file (.sh, .ps1, .py, or .bat and .cmd on Windows). Can be defined multiple times for many tasks")
+	flag.Var(&taskList, "t", "A manually defined task to run. Can be a command or a path to a local script file (.sh, .ps1, .py, or .bat and .cmd on Windows). Can be defined multiple times for many tasks")
+	flag.Var(durationMultiFlag{&schedules}, "duration", "How often a task should run (hourly, minutely etc). Needs to be defined at least once for each task unless a cron expression is used instead. A comma separated list (e.g. 1h,5m) runs a copy of the task on each interval")
+	flag.Var(durationMultiFlag{&schedules}, "d", "How often a task should run (hourly, minutely etc). Needs to be defined at least once for each task unless a cron expression is used instead. A comma separated list (e.g. 1h,5m) runs a copy of the task on each interval")
+	flag.Var(atMultiFlag{&schedules}, "at", "A time to run a task once at instead of repeating it. Either an RFC3339 timestamp or HH:MM for later today. Can be used in place of a duration for any task")
+	flag.Var(cronMultiFlag{&schedules}, "cron", "A five field cron expression (e.g. \"0 3 * * *\") for when a task should run, or six fields with seconds first (e.g. \"*/30 * * * * *\"). Can be used in place of a duration for any task")
+	var nameList stringMultiFlag
+	flag.Var(&nameList, "name", "A name to use for a task in logs instead of its command. Can use {{.Hostname}}, {{.Index}} (the task's position, from 1) and {{.Command}}. Pairs with tasks in the order given and needs to be unique. Defaults to the task's command")
+	var timeoutList durationValueMultiFlag
+	flag.Var(&timeoutList, "timeout", "How long a task can run before it's killed, along with any child processes. Pairs with tasks in the order given. Defaults to no timeout")
+	var retriesList intMultiFlag
+	var retryDelayList durationValueMultiFlag
+	flag.Var(&retriesList, "retries", "How many times to retry a task that exits with a failure before waiting for its next run. Pairs with tasks in the order given. Defaults to 0")
+	var retryOnCodesList exitCodesMultiFlag
+	flag.Var(&retryOnCodesList, "retry-on-codes", "A comma separated list of exit codes to retry a task on (e.g. \"1,75\"), failures with any other exit code aren't retried. Pairs with tasks in the order given. Defaults to retrying any failure")
+	flag.Var(&retryDelayList, "retry-delay", "How long to wait between retries of a failed task. Pairs with tasks in the order given. Defaults to retrying immediately")
+	var offsetList durationValueMultiFlag
+	flag.Var(&offsetList, "offset", "How long to wait before a task's schedule starts, to stagger tasks on the same interval by a fixed amount. Also delays --run-at-start. Pairs with tasks in the order given. Only works with durations. Defaults to no offset")
+	var maxRunsList intMultiFlag
+	flag.Var(&maxRunsList, "max-runs", "How many times a task can run before it stops being scheduled. Pairs with tasks in the order given. Defaults to 0, no limit")
+	envList := envMultiFlag{taskList: &taskList, envs: map[int][]string{}}
+	flag.Var(envList, "env", "An environment variable (KEY=VALUE) to give to the task declared before it. Can be defined multiple times. A lone KEY forwards the scheduler's own value")
+	quietList := quietFlag{taskList: &taskList, quiet: map[int]bool{}}
+	flag.Var(quietList, "quiet", "Only log the runs of the task declared before it that fail, leaving out successful runs and their output")
+	verbose := flag.Bool("verbose", false, "Also log the command being run before each run of every task that isn't --quiet")
+	var runAsUserList stringMultiFlag
+	flag.Var(&runAsUserList, "run-as-user", "The user to run a task as, by name or id. Pairs with tasks in the order given. Needs the scheduler to run as root, and only works on Unix. Defaults to the scheduler's user")
+	var runAsGroupList stringMultiFlag
+	flag.Var(&runAsGroupList, "run-as-group", "The group to run a task as, by name or id. Pairs with tasks in the order given. Only works on Unix. Defaults to the user's group")
+	var niceList niceMultiFlag
+	flag.Var(&niceList, "nice", "The CPU niceness to run a task with, from -20 (most favoured) to 19 (least favoured). Pairs with tasks in the order given. Only works on Unix, and values below the scheduler's need root. Defaults to the scheduler's niceness")
+	var ioniceList stringMultiFlag
+	flag.Var(&ioniceList, "ionice", "The IO priority to run a task with, either idle, best-effort:<0-7> or realtime:<0-7> where lower levels are favoured, like ionice. Pairs with tasks in the order given. Only works on Linux. Defaults to the scheduler's IO priority")
+	var envFileList stringMultiFlag
+	flag.Var(&envFileList, "env-file", "A dotenv file of KEY=VALUE env vars to give a task, read before every run so secrets stay off the command line. Supports # comments and quoted values. Pairs with tasks in the order given. --env takes precedence over it")
+	var outputFileList stringMultiFlag
+	flag.Var(&outputFileList, "output-file", "A file to write a task's stdout to on every run instead of the log, e.g. for a report. Pairs with tasks in the order given. Defaults to logging stdout")
+	outputFileMode := flag.String("output-file-mode", scheduler.OutputFileTruncate, "What each run does to its task's --output-file, either truncate (only keep the latest run's output) or append (keep every run's output)")
+	var pingURLList stringMultiFlag
+	flag.Var(&pingURLList, "ping-url", "A URL to send a GET to after every successful run of a task, for a dead man's switch service like Healthchecks.io to alert when the pings stop. Pings are best effort and failures are logged. Pairs with tasks in the order given. Defaults to no pings")
+	pingStartAndFail := flag.Bool("ping-start-and-fail", false, "Also ping each task's --ping-url with /start added when a run starts and /fail added when a run fails, so the service can track how long runs take and alert on failures straight away")
+	var labelList labelsMultiFlag
+	flag.Var(&labelList, "label", "Comma separated name=value labels to give a task (e.g. \"env=prod,team=infra\"), added to its Prometheus metrics and shown by the HTTP API, which can filter tasks by them with ?tag=team:infra. Pairs with tasks in the order given. Defaults to no labels")
+	var stdinList stringMultiFlag
+	flag.Var(&stdinList, "stdin", "What to feed a task on stdin, e.g. a query for psql. Either the content itself or @ followed by a file to read it from on every run, where a missing file skips the run. Pairs with tasks in the order given. Defaults to no stdin")
+	var priorityList priorityMultiFlag
+	flag.Var(&priorityList, "priority", "Which task goes first when several are waiting for a turn under --serial or --max-concurrent, highest first. Tasks with the same priority go in the order they started waiting, and negative priorities go behind tasks without one. Pairs with tasks in the order given. Defaults to 0")
+	var guardList stringMultiFlag
+	flag.Var(&guardList, "guard", "A command to run before each of a task's runs, which has to exit with 0 for the run to go ahead (e.g. \"test -f /mnt/backup/.mounted\"). Runs that don't pass are skipped and logged. Runs with the task's --timeout. Pairs with tasks in the order given. Defaults to always running")
+	httpTaskList := httpTaskFlag{taskList: &taskList, httpTasks: map[int]bool{}}
+	flag.Var(httpTaskList, "http-task", "A task that sends an HTTP request directly instead of running a program, given as \"METHOD URL\" (e.g. \"POST https://example.com/refresh\"), or a lone URL to send a GET. Responses outside 2xx count as failures. Pairs with the other flags in the order given like --task")
+	httpAuthList := httpAuthFlag{taskList: &taskList, httpAuths: map[int]string{}}
+	flag.Var(httpAuthList, "http-auth", "The user:password to send as basic auth with the --http-task declared before it. Defaults to sending no credentials")
+	afterList := afterFlag{taskList: &taskList, afters: map[int]string{}}
+	flag.Var(afterList, "after", "The name of another task that has to have succeeded on its most recent run for the task declared before it to run. Defaults to not depending on any task")
+	expandEnv := flag.Bool("expand-env", false, "Replace $VAR and ${VAR} in every task's command, script path and working directory with the scheduler's env vars when the tasks are loaded. Unset vars are replaced with nothing")
+	var cwdList stringMultiFlag
+	flag.Var(&cwdList, "cwd", "The working directory to run a task in. Pairs with tasks in the order given. Defaults to the scheduler's current directory")
+	shell := flag.String("shell", "", "The shell to run .sh scripts with, and commands with when --use-shell is set. Defaults to $SHELL, then bash from the PATH for scripts and sh for commands")
+	useShell := flag.Bool("use-shell", false, "Run commands through a shell (sh -c, or --shell) so they can use pipes, globs, && and other shell syntax. Only use it with commands you trust. Defaults to starting each command's program directly")
+	overlap := flag.String("overlap", scheduler.OverlapWait, "What to do when a task is due to run while its last run is still going. Either wait (run once the last run finishes), queue (the same as wait but logs the run was queued) or skip (don't run until the next scheduled time)")
+	flag.StringVar(&httpAddr, "http-addr", "", "The address to serve the HTTP API for listing, running, pausing and resuming tasks on (e.g. :8080). Defaults to not serving the API")
+	supervise := flag.Bool("supervise", false, "Restart a task's scheduling if it panics instead of letting it crash the scheduler, waiting from a second up to a minute longer before each restart")
+	superviseMaxRestarts := flag.Int("supervise-max-restarts", 5, "With --supervise, how many times a task's scheduling is restarted before it's given up on")
+	historySize := flag.Int("history-size", 10, "How many of each task's most recent runs to keep in memory, with the end of their output, for the HTTP API's /tasks/{name}/logs endpoint. 0 keeps none")
+	flag.StringVar(&healthAddr, "health-addr", "", "The address to serve liveness (/healthz) and readiness (/readyz) probes on (e.g. :8081). Defaults to not serving them")
+	flag.DurationVar(&reloadInterval, "reload-interval", 0, "How often to check the --file and --config files for changes, reloading the tasks the same way as SIGHUP once a changed file has stopped changing for a whole interval. Defaults to only reloading on SIGHUP")
+	flag.DurationVar(&heartbeatInterval, "heartbeat", 0, "How often to log that the scheduler is still running, with how many tasks it has and how long it's been up, so it can be seen nothing has silently died. Defaults to no heartbeat")
+	flag.StringVar(&metricsAddr, "metrics-addr", "", "The address to serve Prometheus metrics on (e.g. :9090), at /metrics. Defaults to not serving metrics")
+	maxConcurrent := flag.Int("max-concurrent", 0, "The most tasks that can run at the same time. Tasks due while the limit is reached wait for a running task to finish, or are skipped if --overlap is skip. Defaults to 0, no limit")
+	strictDuplicates := flag.Bool("strict-duplicates", false, "Stop with an error when two tasks run the same command on the same schedule, instead of warning about it. Tasks that share a name are always an error")
+	serial := flag.Bool("serial", false, "Only run one task at a time across the whole scheduler, queueing runs that become due in the order they were due. Stronger than --max-concurrent 1 as it keeps that order. Queued runs are skipped if the scheduler stops")
+	retryJitter := flag.Duration("retry-jitter", 0, "Move each retry's --retry-delay a random amount up to this duration earlier or later, so many schedulers retrying the same failing dependency don't all retry at once. Never goes below no delay. Defaults to no jitter")
+	seed := flag.Int64("seed", 0, "A fixed seed for the random --jitter and --retry-jitter delays so they're the same on every start, for testing. Don't use it in production, as every start picking the same delays defeats the point of spreading runs out. Defaults to 0, a different seed every start")
+	jitter := flag.Duration("jitter", 0, "Delay each run of every task by a random amount up to this duration so tasks on the same schedule don't all start at once. Defaults to no delay")
+	defaultDuration := flag.Duration("default-duration", 0, "How often to run the --task flags that weren't given their own duration or cron value, so many tasks on the same schedule don't each need a -d. Tasks given their own still use it. Defaults to every task needing its own")
+	minInterval := flag.Duration("min-interval", 0, "The shortest interval a task can run on, to guard against typos like -d 1s on an expensive task. Shorter intervals are refused or raised to it depending on --min-interval-mode. Defaults to no minimum")
+	minIntervalMode := flag.String("min-interval-mode", "reject", "What to do with a task whose interval is below --min-interval, either reject (refuse to start) or clamp (warn and run it on --min-interval instead)")
+	backoffAfter := flag.Int("backoff-after", 0, "How many runs in a row of an interval task need to fail before its interval starts doubling with every further failure, until a run succeeds. Defaults to 0, never backing off")
+	maxFailures := flag.Int("max-failures", 0, "How many runs in a row of a task can fail before it stops being scheduled, until the scheduler restarts or the task is changed by a reload. Defaults to 0, never stopping")
+	maxFailuresWebhook := flag.String("max-failures-webhook", "", "A URL to post a JSON message to when a task stops being scheduled because of --max-failures. Defaults to not sending messages")
+	backoffMax := flag.Duration("backoff-max", 0, "The longest a task's interval can back off to with --backoff-after. Defaults to 16 times the interval")
+	runAtStart := flag.Bool("run-at-start", false, "Run every task once as soon as the scheduler starts instead of waiting for their first scheduled time")
+	statePath := flag.String("state-file", "", "A file to save when each task last succeeded in, so --catch-up can run tasks that were missed while the scheduler was stopped. Defaults to not saving anything")
+	mergeOutput := flag.Bool("merge-output", false, "Capture each task's stdout and stderr together in the order they were written, instead of logging them separately")
+	streamOutput := flag.Bool("stream-output", false, "Log each line of a task's output as soon as it's written instead of all together once the run finishes")
+	shutdownGrace := flag.Duration("shutdown-grace", 30*time.Second, "How long to wait for running tasks to finish when the scheduler is stopped with SIGINT or SIGTERM before killing them. 0 waits however long they take")
+	maxOutputBytes := flag.Int64("max-output-bytes", 1024*1024, "The most bytes of each of a task's stdout and stderr to keep from a run, anything past it is cut off. -1 keeps everything")
+	slackWebhook := flag.String("slack-webhook", "", "A Slack incoming webhook URL to post a message to whenever a task fails, once it has used up its retries. Defaults to not sending messages")
+	catchUp := flag.Bool("catch-up", false, "Run tasks straight away on start if they missed a scheduled run while the scheduler was stopped. Needs --state-file")
+	flag.BoolVar(&dryRun, "dry-run", false, "Check every task parses correctly and print a summary of them without running anything. Exits with a non-zero code if anything is wrong")
+	flag.BoolVar(&listTasks, "list-tasks", false, "Print every task along with its schedule and when it will next run, then exit without running anything")
+	flag.BoolVar(&listTasksJSON, "list-tasks-json", false, "The same as --list-tasks but prints the tasks as a JSON array for other tools to read")
+	logDirPath := flag.String("log-dir", "", "A directory to also write each task's output to, in a file per task named after the task. Defaults to only using the main log")
+	logfilePath := flag.String("logs", defaultLogPath, "Where to output application logs")
+	useSyslog := flag.Bool("syslog", false, "Send application logs to the local syslog daemon instead of the --logs file. Errors and warnings are sent at their own priorities. Not supported on Windows")
+	syslogFacility := flag.String("syslog-facility", "daemon", "The syslog facility to log under with --syslog, e.g. daemon, user or local0")
+	syslogTag := flag.String("syslog-tag", "task-scheduler", "The tag to log under with --syslog")
+	configPath := flag.String("config", "", "The location of a YAML or JSON (.json) config file describing a list of tasks. Can be used alongside tasks from flags and --file")
+	logMaxSize := flag.Int("log-max-size", 0, "The size in MB the log file can grow to before it's rotated. Defaults to never rotating")
+	logMaxBackups := flag.Int("log-max-backups", 3, "How many rotated log files to keep when --log-max-size is set")
+	colorMode := flag.String("color", "auto", "When to colour log levels written to the terminal: auto (only when stderr is a terminal and NO_COLOR isn't set), always or never. The log file and syslog are never coloured")
+	flag.Func("log-format", "The format to write logs in, either text or json. Defaults to text", scheduler.SetLogFormat)
+	var taskFilePaths stringMultiFlag
+	flag.Var(&taskFilePaths, "file", "The location of a predefined task file, or - to read it from stdin. Can be defined multiple times to load tasks from many files, in the order given. Should have one task per line in the following format: \"/etc/path/to/my/script.sh 2h5m10s\" to run the designated script / task every 2hrs 5mins and 10 seconds")
+	flag.BoolVar(&skipCommandChecks, "skip-command-checks", false, "Don't check every task's program is on the PATH and every script file exists before starting, for tasks that run something an earlier task creates")
+	tzName := flag.String("tz", "", "The IANA timezone (e.g. America/New_York) to read cron expressions and HH:MM --at times in. Defaults to the host's local time")
+	flag.BoolVar(&runOnce, "once", false, "Run every task once, one after the other, then exit. Exits with a non-zero code if any task failed. Schedules are ignored")
+	requireTasks := flag.Int("require-tasks", 0, "The fewest enabled tasks the scheduler needs to have loaded, exiting with a non-zero code if there are fewer. Defaults to 0, no minimum")
+	flag.StringVar(&pidFilePath, "pidfile", "", "A file to write the scheduler's PID to while it runs, removed when it stops. The scheduler won't start if the file names a scheduler that's still running. Defaults to not writing one")
+	showVersion := flag.Bool("version", false, "Print the version of the scheduler and exit")
+	showConfigSchema := flag.Bool("config-schema", false, "Print the JSON schema of the --config file format, for editors to validate YAML or JSON config files against, and exit")
 	flag.Parse()
 
-	if len(taskList) > len(durationList) {
-		// Can't continue execution
-		log.Fatal("Not all tasks were provided with durations. Every task needs a matching duration value to continue")
+	switch *colorMode {
+	case "auto":
+		_, noColor := os.LookupEnv("NO_COLOR")
+		scheduler.SetLogColor(!noColor && isTerminal(os.Stderr))
+	case "always":
+		scheduler.SetLogColor(true)
+	case "never":
+	default:
+		logFatal(fmt.Sprintf("Unknown --color \"%s\", expected auto, always or never", *colorMode))
+	}
+
+	if *showVersion {
+		fmt.Printf("task-scheduler %s\n", versionInfo())
+		os.Exit(0)
+	}
+	if *showConfigSchema {
+		if err := printConfigSchema(); err != nil {
+			logFatal(fmt.Sprintf("Failed to print the config schema. %v", err))
+		}
+		os.Exit(0)
+	}
+	if listTasksJSON {
+		listTasks = true
+	}
+
+	if *tzName != "" {
+		location, err := time.LoadLocation(*tzName)
+		if err != nil {
+			logFatal(fmt.Sprintf("--tz %s isn't a known timezone. %v", *tzName, err))
+		}
+		timezone = location
+	}
+	for i := range schedules {
+		if schedules[i].atText != "" {
+			// Already checked when the flag was read
+			schedules[i].runAt, _ = parseAtTime(schedules[i].atText, time.Now().In(timezone))
+		}
+	}
+
+	if *jitter < 0 || *retryJitter < 0 {
+		logFatal("--jitter and --retry-jitter can't be negative")
+	}
+	if err := scheduler.ValidateOverlapMode(*overlap); err != nil {
+		logFatal(err.Error())
+	}
+	if err := scheduler.ValidateOutputFileMode(*outputFileMode); err != nil {
+		logFatal(err.Error())
+	}
+	if *minInterval < 0 {
+		logFatal("--min-interval can't be negative")
+	}
+	if *minIntervalMode != "reject" && *minIntervalMode != "clamp" {
+		logFatal(fmt.Sprintf("Unknown --min-interval-mode \"%s\", expected reject or clamp", *minIntervalMode))
+	}
+	if *maxConcurrent < 0 {
+		logFatal("--max-concurrent can't be negative")
+	}
+	for flagName, webhook := range map[string]string{"slack-webhook": *slackWebhook, "max-failures-webhook": *maxFailuresWebhook} {
+		if webhook == "" {
+			continue
+		}
+		if webhookURL, err := url.Parse(webhook); err != nil || (webhookURL.Scheme != "http" && webhookURL.Scheme != "https") {
+			logFatal(fmt.Sprintf("--%s %s should be an http or https URL", flagName, webhook))
+		}
+	}
+	if *maxFailures < 0 {
+		logFatal("--max-failures can't be negative")
+	}
+	if *shutdownGrace < 0 {
+		logFatal("--shutdown-grace can't be negative")
+	}
+	if *maxOutputBytes == 0 || *maxOutputBytes < -1 {
+		logFatal("--max-output-bytes needs to be more than 0, or -1 to keep all of the output")
+	}
+	if *backoffAfter < 0 || *backoffMax < 0 {
+		logFatal("--backoff-after and --backoff-max can't be negative")
+	}
+	if *requireTasks < 0 {
+		logFatal("--require-tasks can't be negative")
+	}
+	if *superviseMaxRestarts < 1 {
+		logFatal("--supervise-max-restarts must be at least 1")
+	}
+	maxSchedulingRestarts := 0
+	if *supervise {
+		maxSchedulingRestarts = *superviseMaxRestarts
+	}
+	if reloadInterval < 0 {
+		logFatal("--reload-interval can't be negative")
+	}
+	if *historySize < 0 {
+		logFatal("--history-size can't be negative")
+	}
+	stdinFiles := 0
+	for _, taskFilePath := range taskFilePaths {
+		if taskFilePath == "-" {
+			stdinFiles++
+		}
+	}
+	if stdinFiles > 1 {
+		logFatal("--file - can only be given once, stdin can't be read more than once")
+	}
+
+	if *defaultDuration < 0 {
+		logFatal("--default-duration can't be negative")
+	}
+	// Schedules pair with tasks in order, so the tasks left without one are the ones at the end
+	for *defaultDuration > 0 && len(schedules) < len(taskList) {
+		schedules = append(schedules, taskSchedule{timeBetweenRuns: *defaultDuration})
+	}
+
+	sources = taskSources{
+		taskList:         taskList,
+		schedules:        schedules,
+		names:            nameList,
+		timeouts:         timeoutList,
+		retries:          retriesList,
+		maxRuns:          maxRunsList,
+		offsets:          offsetList,
+		retryDelays:      retryDelayList,
+		retryOnCodes:     retryOnCodesList,
+		cwds:             cwdList,
+		runAsUsers:       runAsUserList,
+		runAsGroups:      runAsGroupList,
+		nices:            niceList,
+		ionices:          ioniceList,
+		envFiles:         envFileList,
+		outputFiles:      outputFileList,
+		guards:           guardList,
+		stdins:           stdinList,
+		labels:           labelList,
+		pingURLs:         pingURLList,
+		priorities:       priorityList,
+		afters:           afterList.afters,
+		httpTasks:        httpTaskList.httpTasks,
+		httpAuths:        httpAuthList.httpAuths,
+		envs:             envList.envs,
+		quiet:            quietList.quiet,
+		verbose:          *verbose,
+		overlap:          *overlap,
+		outputMode:       *outputFileMode,
+		minInterval:      *minInterval,
+		clampInterval:    *minIntervalMode == "clamp",
+		jitter:           *jitter,
+		retryJitter:      *retryJitter,
+		backoffAfter:     *backoffAfter,
+		backoffMax:       *backoffMax,
+		maxFailures:      *maxFailures,
+		runAtStart:       *runAtStart,
+		expandEnv:        *expandEnv,
+		taskFilePaths:    taskFilePaths,
+		configPath:       *configPath,
+		strictDuplicates: *strictDuplicates,
+		pingStartAndFail: *pingStartAndFail,
+	}
+	builtTasks, err := sources.buildTasks()
+	if err != nil {
+		logFatal(err.Error())
+	}
+
+	if *catchUp && *statePath == "" {
+		logFatal("--catch-up needs a --state-file to know which runs were missed")
+	}
+	if *logMaxSize < 0 || *logMaxBackups < 0 {
+		logFatal("--log-max-size and --log-max-backups can't be negative")
+	}
+	if *useSyslog {
+		if err := checkSyslogOptions(*syslogFacility); err != nil {
+			logFatal(err.Error())
+		}
+	}
+	taskScheduler, err = scheduler.New(scheduler.Options{
+		MaxConcurrent:         *maxConcurrent,
+		Serial:                *serial,
+		Seed:                  *seed,
+		StateFile:             *statePath,
+		CatchUp:               *catchUp,
+		Shell:                 *shell,
+		UseShell:              *useShell,
+		Location:              timezone,
+		TaskLogDir:            *logDirPath,
+		TaskLogMaxSize:        int64(*logMaxSize) * 1024 * 1024,
+		TaskLogMaxBackups:     *logMaxBackups,
+		MergeOutput:           *mergeOutput,
+		StreamOutput:          *streamOutput,
+		MaxOutputBytes:        *maxOutputBytes,
+		ShutdownGracePeriod:   *shutdownGrace,
+		SlackWebhookURL:       *slackWebhook,
+		MaxFailuresWebhookURL: *maxFailuresWebhook,
+		HistorySize:           *historySize,
+		MaxSchedulingRestarts: maxSchedulingRestarts,
+	})
+	if err != nil {
+		logFatal(err.Error())
+	}
+	for _, task := range builtTasks {
+		if err := taskScheduler.AddTask(task); err != nil {
+			logFatal(err.Error())
+		}
+	}
+	// Checked once every task has been added, as a task can run after one that's given later
+	if err := taskScheduler.CheckDependencies(); err != nil {
+		logFatal(err.Error())
+	}
+	if enabledTasks := countEnabledTasks(); enabledTasks < *requireTasks {
+		logFatal(fmt.Sprintf("Only %d enabled task(s) were loaded but --require-tasks needs at least %d", enabledTasks, *requireTasks))
+	}
+
+	// Checked before the log file is set up so the problems are shown straight away. Dry runs check and report separately
+	if !dryRun && !listTasks && !checkTasksRunnable() {
+		logFatal("Some tasks can't be run. Pass --skip-command-checks if their programs or scripts are created by an earlier task")
+	}
+
+	// Setup logging
+	if !dryRun && !listTasks {
+		// Leave logging on stderr for dry runs so any problems are shown straight away
+		if *useSyslog {
+			setupSyslog(*syslogFacility, *syslogTag)
+		} else {
+			setupLogFile(*logfilePath, int64(*logMaxSize)*1024*1024, *logMaxBackups)
+		}
+		// Neither the log file nor syslog is a terminal, so they're never coloured whatever --color is
+		scheduler.SetLogColor(false)
+	}
+}
+
+// Everything the task list is built from. Kept after starting so the task file and config can be read again on reload
+type taskSources struct {
+	// The tasks and settings given as flags, paired with tasks by the order they were given
+	taskList     stringMultiFlag
+	schedules    scheduleList
+	names        stringMultiFlag
+	timeouts     durationValueMultiFlag
+	retries      intMultiFlag
+	maxRuns      intMultiFlag
+	offsets      durationValueMultiFlag
+	retryDelays  durationValueMultiFlag
+	retryOnCodes exitCodesMultiFlag
+	cwds         stringMultiFlag
+	runAsUsers   stringMultiFlag
+	runAsGroups  stringMultiFlag
+	nices        niceMultiFlag
+	ionices      stringMultiFlag
+	envFiles     stringMultiFlag
+	outputFiles  stringMultiFlag
+	guards       stringMultiFlag
+	stdins       stringMultiFlag
+	labels       labelsMultiFlag
+	pingURLs     stringMultiFlag
+	priorities   priorityMultiFlag
+	envs         map[int][]string
+	quiet        map[int]bool
+	afters       map[int]string
+	httpTasks    map[int]bool
+	httpAuths    map[int]string
+	// Defaults for every task
+	verbose      bool
+	overlap      string
+	outputMode   string
+	jitter       time.Duration
+	retryJitter  time.Duration
+	backoffAfter int
+	backoffMax   time.Duration
+	maxFailures  int
+	runAtStart   bool
+	expandEnv    bool
+	// The shortest interval a task can have, and whether shorter ones are raised to it rather than refused
+	minInterval   time.Duration
+	clampInterval bool
+	// Whether two tasks running the same command on the same schedule stops the scheduler rather than being warned about
+	strictDuplicates bool
+	// Whether tasks with a ping URL also ping it when their runs start and fail
+	pingStartAndFail bool
+	// The files to read more tasks from. Empty if they weren't given
+	taskFilePaths stringMultiFlag
+	configPath    string
+}
+
+// Builds the full task list from the flags, task files, config file and env vars, in that order. No source overrides
+// another, each only adds tasks, and as names need to be unique a name used by two sources stops the scheduler rather
+// than one winning. The flags that apply to every task (e.g. --jitter) are defaults for tasks from every source, which
+// a config file's own setting for a task takes precedence over
+func (s taskSources) buildTasks() ([]scheduler.Task, error) {
+	// Copy the flag values so reading the task file again doesn't add to them
+	taskList := append(stringMultiFlag{}, s.taskList...)
+	schedules := append(scheduleList{}, s.schedules...)
+	// Which tasks were marked as disabled in the task file, by their index in the task list
+	disabled := map[int]bool{}
+	// Where each task came from, by its index in the task list, for the duplicate task messages
+	var origins []string
+	for range s.taskList {
+		origins = append(origins, "--task flags")
+	}
+	// Check the flags line up before adding file tasks, otherwise file tasks would be paired with leftover flag durations
+	if err := validateTaskSchedules(taskList, schedules); err != nil {
+		return nil, err
 	}
 
-	// Read tasks from the defined file if it was provided
-	if *taskFilePath != "" {
+	// Read tasks from the defined files if any were provided, in the order they were given
+	for _, taskFilePath := range s.taskFilePaths {
 		println("Reading tasks file")
-		fileTasks, fileDurations := parseTasksFile(*taskFilePath)
+		fileTasks, fileSchedules, fileDisabled, err := parseTasksFile(taskFilePath)
+		if err != nil {
+			// Log but don't stop the application, use the tasks that could be read instead
+			scheduler.LogError(err.Error())
+		}
+		for i := range fileDisabled {
+			disabled[len(taskList)+i] = fileDisabled[i]
+		}
 		taskList = append(taskList, fileTasks...)
-		durationList = append(durationList, fileDurations...)
+		for range fileTasks {
+			origins = append(origins, fmt.Sprintf("--file %s", taskFilePath))
+		}
+		schedules = append(schedules, fileSchedules...)
+
+		if err := validateTaskSchedules(taskList, schedules); err != nil {
+			return nil, err
+		}
 	}
 
-	// Create the task list
+	// Create the task list, along with where each built task came from
+	var builtTasks []scheduler.Task
+	var builtOrigins []string
+	hostname, _ := os.Hostname()
 	for i := 0; i < len(taskList); i++ {
 		taskCommand := taskList[i]
 
-		thisTask := Task{
-			taskText:        strings.Trim(taskCommand, "\""),
-			isShellScript:   strings.HasSuffix(taskCommand, ".sh"),
-			timeBetweenRuns: durationList[i],
-			mutex:           &sync.Mutex{},
+		thisTask := scheduler.Task{
+			Command:      strings.Trim(taskCommand, "\""),
+			Interval:     schedules[i].timeBetweenRuns,
+			Cron:         schedules[i].cronSpec,
+			At:           schedules[i].runAt,
+			Overlap:      s.overlap,
+			Jitter:       s.jitter,
+			RetryJitter:  s.retryJitter,
+			BackoffAfter: s.backoffAfter,
+			BackoffMax:   s.backoffMax,
+			MaxFailures:  s.maxFailures,
+			RunAtStart:   s.runAtStart,
+			Disabled:     disabled[i],
+		}
+		if i < len(s.names) {
+			thisTask.Name = s.names[i]
+		}
+		if i < len(s.timeouts) {
+			thisTask.Timeout = s.timeouts[i]
+		}
+		if i < len(s.retries) {
+			thisTask.Retries = s.retries[i]
+		}
+		if i < len(s.maxRuns) {
+			thisTask.MaxRuns = s.maxRuns[i]
+		}
+		if i < len(s.offsets) {
+			thisTask.Offset = s.offsets[i]
+		}
+		if i < len(s.retryDelays) {
+			thisTask.RetryDelay = s.retryDelays[i]
+		}
+		if i < len(s.retryOnCodes) {
+			thisTask.RetryOnCodes = s.retryOnCodes[i]
+		}
+		if i < len(s.cwds) {
+			thisTask.WorkingDir = s.cwds[i]
+		}
+		if i < len(s.runAsUsers) {
+			thisTask.User = s.runAsUsers[i]
+		}
+		if i < len(s.runAsGroups) {
+			thisTask.Group = s.runAsGroups[i]
+		}
+		if i < len(s.nices) {
+			thisTask.Nice = s.nices[i]
+		}
+		if i < len(s.ionices) {
+			thisTask.IONice = s.ionices[i]
+		}
+		if i < len(s.envFiles) {
+			thisTask.EnvFile = s.envFiles[i]
+		}
+		if i < len(s.pingURLs) {
+			thisTask.PingURL = s.pingURLs[i]
+			thisTask.PingStartAndFail = s.pingStartAndFail
+		}
+		if i < len(s.priorities) {
+			thisTask.Priority = s.priorities[i]
+		}
+		if i < len(s.labels) {
+			thisTask.Labels = s.labels[i]
+		}
+		if i < len(s.stdins) {
+			thisTask.Stdin = s.stdins[i]
+		}
+		if i < len(s.guards) {
+			thisTask.Guard = s.guards[i]
+		}
+		if i < len(s.outputFiles) {
+			thisTask.OutputFile = s.outputFiles[i]
+			thisTask.OutputFileMode = s.outputMode
+		}
+		thisTask.Env = s.envs[i]
+		thisTask.After = s.afters[i]
+		thisTask.HTTP = s.httpTasks[i]
+		thisTask.HTTPBasicAuth = s.httpAuths[i]
+		switch {
+		case s.quiet[i]:
+			thisTask.Verbosity = scheduler.VerbosityQuiet
+		case s.verbose:
+			thisTask.Verbosity = scheduler.VerbosityVerbose
 		}
 
-		tasks = append(tasks, &thisTask)
+		// Filled in before the copies below are made, so {{.Index}} is the task's position in the task list for every
+		// copy. {{.Command}} matches what runs, the same as for the other sources below
+		command := thisTask.Command
+		if s.expandEnv {
+			command = os.ExpandEnv(command)
+		}
+		name, err := expandTaskName(thisTask.Name, taskNameValues{Hostname: hostname, Index: i + 1, Command: command})
+		if err != nil {
+			return nil, err
+		}
+		thisTask.Name = name
+
+		builtTasks = append(builtTasks, thisTask)
+		builtOrigins = append(builtOrigins, origins[i])
+
+		// Every interval after the first runs its own copy of the task, numbered like the HTTP API numbers tasks that
+		// share a name so the names stay unique. Copies of a task without a name are numbered after its command
+		for copyIndex, interval := range schedules[i].moreIntervals {
+			taskCopy := thisTask
+			taskCopy.Interval = interval
+			baseName := thisTask.Name
+			if baseName == "" {
+				baseName = command
+			}
+			taskCopy.Name = fmt.Sprintf("%s-%d", baseName, copyIndex+2)
+			builtTasks = append(builtTasks, taskCopy)
+			builtOrigins = append(builtOrigins, origins[i])
+		}
 	}
+	// Tasks from the config file and env vars come after the flag and file tasks in the task list
+	flagTaskCount := len(builtTasks)
 
-	// Setup logging
-	setupLogFile(*logfilePath)
+	// Read tasks from the config file if it was provided
+	if s.configPath != "" {
+		println("Reading config file")
+		configTasks, err := loadConfigFile(s.configPath)
+		if err != nil {
+			// A broken config could mean important tasks are missing so don't continue
+			return nil, err
+		}
+		s.applyTaskDefaults(configTasks)
+		builtTasks = append(builtTasks, configTasks...)
+		for range configTasks {
+			builtOrigins = append(builtOrigins, fmt.Sprintf("--config %s", s.configPath))
+		}
+	}
+
+	// Read tasks from TASK_<number>_<field> env vars if any are set
+	envTasks, err := loadEnvTasks(os.Environ())
+	if err != nil {
+		return nil, err
+	}
+	s.applyTaskDefaults(envTasks)
+	builtTasks = append(builtTasks, envTasks...)
+	for range envTasks {
+		builtOrigins = append(builtOrigins, fmt.Sprintf("%s<number>_ env vars", envTaskPrefix))
+	}
+
+	if s.expandEnv {
+		// Expanded once here rather than on every run, so a task always runs the same thing until it's reloaded
+		for i := range builtTasks {
+			builtTasks[i].Command = os.ExpandEnv(builtTasks[i].Command)
+			builtTasks[i].WorkingDir = os.ExpandEnv(builtTasks[i].WorkingDir)
+			builtTasks[i].HTTPBasicAuth = os.ExpandEnv(builtTasks[i].HTTPBasicAuth)
+		}
+	}
+
+	// Filled in after the commands are expanded so {{.Command}} matches what runs. The flag and file tasks' names were
+	// filled in along with their copies
+	for i := flagTaskCount; i < len(builtTasks); i++ {
+		index := len(taskList) + i - flagTaskCount + 1
+		name, err := expandTaskName(builtTasks[i].Name, taskNameValues{Hostname: hostname, Index: index, Command: builtTasks[i].Command})
+		if err != nil {
+			return nil, err
+		}
+		builtTasks[i].Name = name
+	}
+
+	// Checked last so every source is covered, including tasks added by a reload
+	for i := range builtTasks {
+		task := &builtTasks[i]
+		if task.Interval == 0 || task.Interval >= s.minInterval {
+			continue
+		}
+		taskName := task.Name
+		if taskName == "" {
+			taskName = task.Command
+		}
+		if !s.clampInterval {
+			return nil, fmt.Errorf("the interval of %s is %s, shorter than the --min-interval of %s", taskName, scheduler.FormatDuration(task.Interval), scheduler.FormatDuration(s.minInterval))
+		}
+		scheduler.LogWarning(fmt.Sprintf("The interval of %s is %s, shorter than the --min-interval of %s. Running it every %s instead", taskName, scheduler.FormatDuration(task.Interval), scheduler.FormatDuration(s.minInterval), scheduler.FormatDuration(s.minInterval)))
+		task.Interval = s.minInterval
+	}
+
+	if err := checkDuplicateTasks(builtTasks, builtOrigins, s.strictDuplicates); err != nil {
+		return nil, err
+	}
+	return builtTasks, nil
+}
+
+// Fills in the settings the flags give every task for tasks from the config file and env vars, where the task didn't
+// set them itself
+func (s taskSources) applyTaskDefaults(tasks []scheduler.Task) {
+	for i := range tasks {
+		task := &tasks[i]
+		task.RunAtStart = task.RunAtStart || s.runAtStart
+		task.PingStartAndFail = task.PingStartAndFail || s.pingStartAndFail
+		if task.Jitter == 0 {
+			task.Jitter = s.jitter
+		}
+		if task.RetryJitter == 0 {
+			task.RetryJitter = s.retryJitter
+		}
+		if task.Overlap == "" {
+			task.Overlap = s.overlap
+		}
+		if task.OutputFileMode == "" {
+			task.OutputFileMode = s.outputMode
+		}
+		if task.Verbosity == "" && s.verbose {
+			task.Verbosity = scheduler.VerbosityVerbose
+		}
+		if task.BackoffAfter == 0 {
+			task.BackoffAfter = s.backoffAfter
+		}
+		if task.BackoffMax == 0 {
+			task.BackoffMax = s.backoffMax
+		}
+		if task.MaxFailures == 0 {
+			task.MaxFailures = s.maxFailures
+		}
+	}
+}
+
+// The values that can be used in task names as template tokens, e.g. "backup-{{.Hostname}}"
+type taskNameValues struct {
+	// The name of the machine the scheduler is running on
+	Hostname string
+	// The task's position in the task list, starting at 1
+	Index   int
+	Command string
+}
+
+// Fills in any template tokens in a task name. Names without any are left as they are
+func expandTaskName(name string, values taskNameValues) (string, error) {
+	if !strings.Contains(name, "{{") {
+		return name, nil
+	}
+	nameTemplate, err := template.New("name").Parse(name)
+	if err != nil {
+		return "", fmt.Errorf("the task name \"%s\" isn't a valid template. %v", name, err)
+	}
+	var expanded strings.Builder
+	if err := nameTemplate.Execute(&expanded, values); err != nil {
+		return "", fmt.Errorf("the task name \"%s\" can't be filled in, only {{.Hostname}}, {{.Index}} and {{.Command}} can be used. %v", name, err)
+	}
+	return expanded.String(), nil
+}
+
+// Checks every task has exactly one matching duration or cron value, as they're paired up by the order they were given
+func validateTaskSchedules(taskList []string, schedules scheduleList) error {
+	if len(taskList) > len(schedules) {
+		var missing []string
+		for _, task := range taskList[len(schedules):] {
+			missing = append(missing, fmt.Sprintf("\"%s\"", task))
+		}
+		return fmt.Errorf("Not all tasks were provided with durations. No duration or cron value was given for %s. Every task needs a matching duration or cron value to continue, or --default-duration to fall back on", strings.Join(missing, ", "))
+	}
+	if len(schedules) > len(taskList) {
+		var extra []string
+		for _, schedule := range schedules[len(taskList):] {
+			extra = append(extra, schedule.String())
+		}
+		return fmt.Errorf("More durations were provided than tasks. The extra values %s don't belong to any task", strings.Join(extra, ", "))
+	}
+	return nil
 }
 
 func main() {
+	setupFromFlags()
+	if dryRun {
+		os.Exit(printDryRun())
+	}
+	if listTasksJSON {
+		printTaskListJSON(time.Now())
+		return
+	}
+	if listTasks {
+		printTaskList(time.Now())
+		return
+	}
+
 	// Cleanup
-	defer logFile.Close()
+	defer closeLogFile()
 
-	if len(tasks) == 0 {
+	if len(taskScheduler.Tasks()) == 0 {
 		// Can't run nothing
-		log.Fatal("No tasks provided to the application")
+		logFatal("No tasks provided to the application")
+	}
+	if countEnabledTasks() == 0 {
+		logFatal(fmt.Sprintf("All %d task(s) are disabled so there's nothing to run. Enable at least one of them to start the scheduler", len(taskScheduler.Tasks())))
+	}
+
+	if runOnce {
+		writePidFileForRun()
+		exitCode := runEveryTaskOnce()
+		// Exiting skips the deferred cleanup
+		if pidFilePath != "" {
+			removePidFile(pidFilePath)
+		}
+		closeLogFile()
+		os.Exit(exitCode)
+	}
+
+	if metricsAddr != "" {
+		metricsMux := http.NewServeMux()
+		metricsMux.Handle("/metrics", taskScheduler.MetricsHandler())
+		if err := startHTTPServer(metricsAddr, "metrics", metricsMux); err != nil {
+			logFatal(err.Error())
+		}
+	}
+	if httpAddr != "" {
+		if err := startHTTPServer(httpAddr, "HTTP API", taskScheduler.APIHandler()); err != nil {
+			logFatal(err.Error())
+		}
+	}
+	if healthAddr != "" {
+		if err := startHTTPServer(healthAddr, "health", taskScheduler.HealthHandler()); err != nil {
+			logFatal(err.Error())
+		}
+	}
+
+	// Written once nothing else can stop the scheduler starting, so a failed start doesn't leave a pidfile behind
+	writePidFileForRun()
+	if pidFilePath != "" {
+		defer removePidFile(pidFilePath)
 	}
 
 	println("Tasks parsed correctly, now running tasks on a schedule")
+	scheduler.LogInfo(fmt.Sprintf("Starting task scheduler %s with %d task(s)", versionInfo(), len(taskScheduler.Tasks())))
+	logStartupSummary()
 
-	// Skip the first one in the list as it'll be run forever on the main thread
-	for i := 1; i < len(tasks); i++ {
-		go scheduleTask(tasks[i])
+	// Stops the scheduler on Ctrl+C or SIGTERM, giving running tasks the grace period to finish
+	ctx, stopWatchingSignals := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stopWatchingSignals()
+	if err := taskScheduler.Start(ctx); err != nil {
+		logFatal(err.Error())
 	}
+	// Waits for any runs still going and closes the task log files, then logs how every task's runs went
+	defer func() {
+		taskScheduler.Stop()
+		logShutdownSummary()
+	}()
+	if heartbeatInterval > 0 {
+		go logHeartbeats(ctx, time.Now())
+	}
+	go watchForLogReopen(ctx)
+
+	if len(sources.taskFilePaths) > 0 || sources.configPath != "" {
+		if reloadInterval > 0 {
+			go watchFilesForChanges(ctx)
+		}
+		// Only returns once stopping, so the scheduler keeps running for reloads to add tasks even once every task
+		// has stopped
+		watchForReload(ctx)
+	}
+
+	// Tasks that only run once stop being scheduled, so keep running until every task has stopped
+	taskScheduler.Wait()
+}
+
+// Logs every task the scheduler is starting with and its schedule, so the logs show what it started with
+func logStartupSummary() {
+	for _, status := range taskScheduler.Tasks() {
+		schedule := status.Schedule
+		if status.Task.Disabled {
+			schedule += " (disabled)"
+		}
+		scheduler.LogTaskInfo(status.ID, fmt.Sprintf("Loaded task=%s schedule=%s command=%s", status.ID, schedule, status.Task.Command))
+	}
+}
 
-	// Run the first task on the main thread forever to keep the application alive
-	scheduleTask(tasks[0])
+// Logs how many times every task ran and how its runs went once the scheduler has stopped, so the end of the log gives
+// an overview without going through every run
+func logShutdownSummary() {
+	for _, status := range taskScheduler.Tasks() {
+		lastStatus := status.LastStatus
+		if lastStatus == "" {
+			lastStatus = "never_ran"
+		}
+		scheduler.LogTaskInfo(status.ID, fmt.Sprintf("Summary task=%s runs=%d succeeded=%d failed=%d last_status=%s", status.ID, status.Runs, status.Successes, status.Failures, lastStatus))
+	}
 }
 
-// Run a task on a timer user a channel
-func scheduleTask(task *Task) {
+// Logs that the scheduler is still running every --heartbeat until ctx is done
+func logHeartbeats(ctx context.Context, startedAt time.Time) {
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			uptime := scheduler.FormatDuration(time.Since(startedAt))
+			scheduler.LogInfo(fmt.Sprintf("Scheduler alive with %d task(s), uptime %s", len(taskScheduler.Tasks()), uptime))
+		case <-ctx.Done():
+			return
+		}
+	}
+}
 
-	thisTicker := time.NewTicker(task.timeBetweenRuns)
+// Runs every task once for --once and returns the code to exit with, non-zero if any task that isn't disabled didn't
+// succeed
+func runEveryTaskOnce() int {
+	ctx, stopWatchingSignals := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stopWatchingSignals()
+	results, err := taskScheduler.RunOnce(ctx)
+	if err != nil {
+		logFatal(err.Error())
+	}
+	taskScheduler.Stop()
 
-	for range thisTicker.C {
-		// Run the task every tick from the channel (Every duration)
-		go runTask(task)
+	disabled := map[string]bool{}
+	for _, status := range taskScheduler.Tasks() {
+		disabled[status.ID] = status.Task.Disabled
+	}
+	for _, result := range results {
+		if result.Status != scheduler.StatusSuccess && !(result.Status == scheduler.StatusSkipped && disabled[result.ID]) {
+			return 1
+		}
 	}
+	return 0
+}
+
+// Whether a file is a terminal rather than a pipe or regular file
+func isTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
 }
 
-// Parses a tasks file and returns 2 slices with matching indexes, 1 with the tasks and 1 with the durations
-func parseTasksFile(taskFilePath string) ([]string, []time.Duration) {
-	file, err := os.Open(taskFilePath)
+// Run by logFatal before exiting, as exiting skips the deferred cleanup
+var fatalCleanups []func()
 
+// Logs a failure the application can't continue from and exits
+func logFatal(message string) {
+	scheduler.LogError(message)
+	for _, cleanup := range fatalCleanups {
+		cleanup()
+	}
+	os.Exit(1)
+}
+
+// Starts an HTTP server in the background. Listening happens up front so a bad address is reported straight away
+func startHTTPServer(addr string, serverName string, handler http.Handler) error {
+	listener, err := net.Listen("tcp", addr)
 	if err != nil {
-		// Log but don't stop the application, use any existing tasks instead
-		log.Println(fmt.Sprintf("ERROR!: Failed to open taskfile at %s. Not running tasks defined in this file", taskFilePath))
-		return []string{}, []time.Duration{}
+		return fmt.Errorf("failed to start the %s server on %s: %v", serverName, addr, err)
 	}
 
-	fileScanner := bufio.NewScanner(file)
+	go func() {
+		if err := http.Serve(listener, handler); err != nil {
+			scheduler.LogError(fmt.Sprintf("The %s server stopped. %v", serverName, err))
+		}
+	}()
+	return nil
+}
 
-	var fileTasks []string
-	var fileDurations []time.Duration
+// Checks every task can be run and prints a summary of them to stdout. Returns the code to exit with.
+// Everything else was already parsed and validated by init, the same as a real run
+func printDryRun() int {
+	statuses := taskScheduler.Tasks()
+	if len(statuses) == 0 {
+		scheduler.LogError("No tasks provided to the application")
+		return 1
+	}
 
-	for fileScanner.Scan() {
-		task, duration, parseErr := parseTaskFileRow(fileScanner.Text())
-		if parseErr == nil {
-			// Only add to the list if no errors occurred, otherwise skip
-			fileTasks = append(fileTasks, task)
-			fileDurations = append(fileDurations, duration)
+	if !checkTasksRunnable() {
+		return 1
+	}
+
+	summary := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(summary, "NAME\tCOMMAND\tSCHEDULE")
+	for _, status := range statuses {
+		schedule := status.Schedule
+		if status.Task.Disabled {
+			schedule += " (disabled)"
 		}
+		fmt.Fprintf(summary, "%s\t%s\t%s\n", status.ID, status.Task.Command, schedule)
 	}
+	summary.Flush()
+	fmt.Printf("%d task(s) parsed correctly\n", len(statuses))
+	return 0
+}
 
-	if fileScanner.Err() != nil {
-		log.Println(fmt.Sprintf("ERROR!: Failed to read the taskfile. %v", fileScanner.Err()))
+// Checks every task's program or script can be found, logging every problem rather than stopping at the first.
+// Returns whether every task can be run. Always true when --skip-command-checks is set
+func checkTasksRunnable() bool {
+	if skipCommandChecks {
+		return true
 	}
 
-	return fileTasks, fileDurations
+	runnable := true
+	for _, status := range taskScheduler.Tasks() {
+		if status.Task.Disabled {
+			// Won't be run so doesn't need to be runnable yet
+			continue
+		}
+		if err := taskScheduler.CheckRunnable(status.Task); err != nil {
+			scheduler.LogError(fmt.Sprintf("%s can't be run. %v", status.ID, err))
+			runnable = false
+		}
+	}
+	return runnable
 }
 
-// Parses the row of a task file, handling any panics from reading by not returning that task
-func parseTaskFileRow(fileRow string) (string, time.Duration, error) {
-	// Split the row into the quoted task and the duration
-	closeQuoteIndex := 0
+// Counts the tasks that aren't disabled
+func countEnabledTasks() int {
+	enabled := 0
+	for _, status := range taskScheduler.Tasks() {
+		if !status.Task.Disabled {
+			enabled++
+		}
+	}
+	return enabled
+}
 
-	for i, char := range fileRow {
-		if i != 0 {
-			// First character will always be the opening quote so can be skipped
-			if string(char) == "`" {
-				closeQuoteIndex = i + 1
-				break
-			}
+// Prints every task with its schedule and the next time it will run if the scheduler was started now
+func printTaskList(now time.Time) {
+	table := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(table, "NAME\tCOMMAND\tSCHEDULE\tNEXT RUN")
+	for _, status := range taskScheduler.Tasks() {
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\n", status.ID, status.Task.Command, status.Schedule, describeNextRun(status, now))
+	}
+	table.Flush()
+}
+
+// A task as printed by --list-tasks-json
+type listedTask struct {
+	Name     string `json:"name"`
+	Command  string `json:"command"`
+	Schedule string `json:"schedule"`
+	Enabled  bool   `json:"enabled"`
+	// Null when the task will never run
+	NextRun *time.Time `json:"next_run"`
+}
+
+// Prints every task the same as printTaskList, but as a JSON array for other tools to read
+func printTaskListJSON(now time.Time) {
+	// Not nil so no tasks are printed as [] rather than null
+	tasks := []listedTask{}
+	for _, status := range taskScheduler.Tasks() {
+		task := listedTask{
+			Name:     status.ID,
+			Command:  status.Task.Command,
+			Schedule: status.Schedule,
+			Enabled:  !status.Task.Disabled,
+		}
+		if nextRun, runs := taskScheduler.FirstRun(status.ID, now); runs {
+			task.NextRun = &nextRun
 		}
+		tasks = append(tasks, task)
 	}
 
-	task := strings.Trim(fileRow[:closeQuoteIndex], "`")
-	duration := strings.Trim(fileRow[closeQuoteIndex:], " ")
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(tasks); err != nil {
+		logFatal(fmt.Sprintf("Failed to print the task list. %v", err))
+	}
+}
+
+// Describes when a task will first run if the scheduler was started at the given time
+func describeNextRun(status scheduler.TaskStatus, now time.Time) string {
+	isRunOnce := !status.Task.At.IsZero()
+	nextRun, runs := taskScheduler.FirstRun(status.ID, now)
+	switch {
+	case status.Task.Disabled:
+		return "never, the task is disabled"
+	case !runs && isRunOnce:
+		return "never, the time has already passed"
+	case !runs:
+		return "never, the cron expression doesn't match a real date"
+	}
 
-	if duration, err := parseDurationStr(duration); err == nil {
-		return task, duration, nil
-	} else {
-		return "", 0, err
+	description := nextRun.Format(time.RFC3339)
+	// Run once tasks don't use jitter
+	if status.Task.Jitter > 0 && !isRunOnce {
+		description += fmt.Sprintf(" (plus up to %v of jitter)", status.Task.Jitter)
 	}
+	return description
 }
 
-// Parses a duration string and returns error if invalid or in the negatives (valid duration but not valid for application)
-func parseDurationStr(durationText string) (time.Duration, error) {
-	duration, err := time.ParseDuration(durationText)
+// Parses a tasks file and returns 3 slices with matching indexes, 1 with the tasks, 1 with the schedules and 1 with
+// whether each task is disabled. Rows that can't be parsed are logged and skipped. The error is set if the file can't
+// be opened, or if it couldn't be read to the end in which case the tasks before the problem are still returned
+func parseTasksFile(taskFilePath string) ([]string, []taskSchedule, []bool, error) {
+	file, err := openTaskFile(taskFilePath)
 	if err != nil {
-		// Exit application early with warning
-		log.Println(fmt.Sprintf("ERROR!: A duration was entered incorrectly: %v. Only units of (h,m,s,ms) are supported", err))
-		return 0, err
-	} else {
-		// Block negative values
-		if duration < 0 {
-			negativeErr := fmt.Errorf("ERROR!: A duration had a negative value: %s. This application doesn't have the ability to time travel to the past to run tasks", durationText)
-			log.Println(negativeErr)
-			return 0, negativeErr
+		return nil, nil, nil, fmt.Errorf("Failed to open taskfile at %s. Not running tasks defined in this file. %v", taskFilePath, err)
+	}
+	defer file.Close()
+
+	fileScanner := bufio.NewScanner(file)
+
+	var fileTasks []string
+	var fileSchedules []taskSchedule
+	var fileDisabled []bool
+
+	lineNumber := 0
+	for fileScanner.Scan() {
+		lineNumber++
+		row := strings.TrimSpace(fileScanner.Text())
+		if row == "" || strings.HasPrefix(row, "#") {
+			// Blank lines and comments aren't tasks
+			continue
 		}
+
+		row, enabled, parseErr := splitEnabledMarker(row)
+		if parseErr != nil {
+			scheduler.LogError(fmt.Sprintf("Skipping line %d of the taskfile %s. %v", lineNumber, taskFilePath, parseErr))
+			continue
+		}
+		task, schedule, parseErr := parseTaskFileRow(row)
+		if parseErr != nil {
+			// Skip the row but keep the rest of the file
+			scheduler.LogError(fmt.Sprintf("Skipping line %d of the taskfile %s. %v", lineNumber, taskFilePath, parseErr))
+			continue
+		}
+		fileTasks = append(fileTasks, task)
+		fileSchedules = append(fileSchedules, schedule)
+		fileDisabled = append(fileDisabled, !enabled)
 	}
-	return duration, nil
+
+	if fileScanner.Err() != nil {
+		return fileTasks, fileSchedules, fileDisabled, fmt.Errorf("Failed to read the taskfile %s. %v", taskFilePath, fileScanner.Err())
+	}
+	return fileTasks, fileSchedules, fileDisabled, nil
 }
 
-// Sets up the system logger to use the file specified
-func setupLogFile(logPath string) {
+// Removes an -enabled=true or -enabled=false marker from the end of a task file row, returning the rest of the row and
+// whether the task is enabled. Rows without a marker are enabled
+func splitEnabledMarker(row string) (string, bool, error) {
+	markerStart := strings.LastIndexAny(row, " \t")
+	marker := row[markerStart+1:]
+	if markerStart == -1 || !strings.HasPrefix(marker, "-enabled=") || strings.ContainsAny(marker, "`\"'") {
+		return row, true, nil
+	}
 
-	// Open the file as write only, don't care about reading that's for the user
-	file, initialError := os.OpenFile(logPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 644)
-	if initialError != nil {
-		// Attempt to fallback to local logfile if possible
-		if logPath == "./task-scheduler.log" {
-			// Already using the default, can't continue
-			log.Fatal(initialError)
+	enabled, err := strconv.ParseBool(strings.TrimPrefix(marker, "-enabled="))
+	if err != nil {
+		return "", false, fmt.Errorf("%s should be -enabled=true or -enabled=false", marker)
+	}
+	return strings.TrimSpace(row[:markerStart]), enabled, nil
+}
+
+// Everything read from stdin when the task file is "-". Stdin can only be read once, so reloads parse this again
+var stdinTaskFile bytes.Buffer
+var stdinTaskFileRead bool
+
+// Opens the task file, or stdin when the path is "-"
+func openTaskFile(taskFilePath string) (io.ReadCloser, error) {
+	if taskFilePath != "-" {
+		return os.Open(taskFilePath)
+	}
+	if stdinTaskFileRead {
+		return io.NopCloser(bytes.NewReader(stdinTaskFile.Bytes())), nil
+	}
+	stdinTaskFileRead = true
+	// Keep a copy of everything the scanner reads. Read errors still come from stdin so they're logged like a file's
+	return io.NopCloser(io.TeeReader(os.Stdin, &stdinTaskFile)), nil
+}
+
+// Parses the row of a task file. The duration is the last value on the row and everything before it is the command,
+// which can be wrapped in backticks or quotes (e.g. "/opt/backup.sh --full now" 6h). Spaces inside quotes don't end the
+// command, so a row where the duration is inside the quotes is rejected rather than guessed at. Quotes only open at
+// the start of a word, so apostrophes like the one in "echo don't 5m" are part of the command. The duration can
+// directly follow a quoted command (e.g. `cmd`1h). A time of day like @09:00 can be given instead of the duration to
+// run the task daily at that time
+func parseTaskFileRow(fileRow string) (string, taskSchedule, error) {
+	row := strings.TrimSpace(fileRow)
+
+	// Find the last space outside of any quotes, the duration starts after it
+	durationStart := -1
+	var quote rune
+	quoteStart := -1
+	for i, char := range row {
+		switch {
+		case quote != 0:
+			if char == quote {
+				quote = 0
+				if quoteStart == 0 {
+					// The end of a quoted command, the duration can start straight after it
+					durationStart = i + 1
+				}
+			}
+		case (char == '`' || char == '"' || char == '\'') && (i == 0 || row[i-1] == ' ' || row[i-1] == '\t'):
+			quote = char
+			quoteStart = i
+		case char == ' ' || char == '\t':
+			durationStart = i + 1
 		}
-		// Not using the default, use fallback
-		log.Println(initialError)
-		log.Println("An error occurred attempting to use a custom log file, falling back to ./task-scheduler.log")
-		defaultFile, err := os.OpenFile("./task-scheduler.log", os.O_CREATE|os.O_APPEND|os.O_WRONLY, 644)
+	}
+	if quote != 0 {
+		return "", taskSchedule{}, fmt.Errorf("the quote %c around the command is never closed", quote)
+	}
+	if durationStart == -1 || durationStart == len(row) {
+		return "", taskSchedule{}, fmt.Errorf("each row needs both a command and a duration separated by a space")
+	}
+
+	task := strings.TrimSpace(row[:durationStart])
+	// Backticks and single quotes only group the command, they aren't part of it. Double quotes are removed with the
+	// same handling as tasks from flags
+	for _, quoteChar := range []string{"`", "'"} {
+		if len(task) >= 2 && strings.HasPrefix(task, quoteChar) && strings.HasSuffix(task, quoteChar) {
+			task = task[1 : len(task)-1]
+		}
+	}
 
+	if scheduleText := row[durationStart:]; strings.HasPrefix(scheduleText, "@") {
+		cronSpec, err := parseDailyTime(scheduleText)
 		if err != nil {
-			// Can't even fall back to default, can't continue
-			log.Fatal("err")
+			return "", taskSchedule{}, err
 		}
-		// Reassign file
-		file = defaultFile
+		return task, taskSchedule{cronSpec: cronSpec}, nil
 	}
+	duration, err := parseDuration(row[durationStart:])
+	if err != nil {
+		return "", taskSchedule{}, err
+	}
+	return task, taskSchedule{timeBetweenRuns: duration}, nil
+}
 
-	// Use as logging output
-	logFile = file
-	log.SetOutput(file)
+// Turns a task file time of day like @09:00 into the cron expression that runs a task daily at that time, in --tz.
+// Only 24 hour H:MM or HH:MM times are accepted, anything that could be read more than one way (e.g. @9, @0900 or
+// @9:00pm) or isn't a time of day (e.g. @24:00) is rejected rather than guessed at
+func parseDailyTime(scheduleText string) (string, error) {
+	hourText, minuteText, hasColon := strings.Cut(strings.TrimPrefix(scheduleText, "@"), ":")
+	invalid := fmt.Errorf("%s isn't a time of day, expected @HH:MM in 24 hour time (e.g. @09:00 or @17:30)", scheduleText)
+	if !hasColon || !isDigits(hourText) || !isDigits(minuteText) || len(hourText) > 2 || len(minuteText) != 2 {
+		return "", invalid
+	}
+	hour, _ := strconv.Atoi(hourText)
+	minute, _ := strconv.Atoi(minuteText)
+	if hour > 23 || minute > 59 {
+		return "", invalid
+	}
+	return fmt.Sprintf("%d %d * * *", minute, hour), nil
 }
 
-// Runs a task that could either be a script or a commandline task.
-// Ensures the task is only run once with a mutex lock
-func runTask(task *Task) {
-	defer task.mutex.Unlock()
+// Whether text is made up only of the digits 0 to 9, and isn't empty
+func isDigits(text string) bool {
+	return text != "" && strings.Trim(text, "0123456789") == ""
+}
 
-	// Lock so no other equivalent task can run at the same time
-	task.mutex.Lock()
-	if task.isShellScript {
-		runBashFile(task.taskText)
-	} else {
-		runCustomCommand(task.taskText)
+// Parses a duration string (e.g. "1h30m"), rejecting negative durations
+func parseDuration(durationText string) (time.Duration, error) {
+	duration, err := parseDurationWithLongUnits(durationText)
+	if err != nil {
+		return 0, fmt.Errorf("A duration was entered incorrectly: %v. Only units of (w,d,h,m,s,ms) are supported", err)
+	}
+	// Block negative values
+	if duration < 0 {
+		return 0, fmt.Errorf("A duration had a negative value: %s. This application doesn't have the ability to time travel to the past to run tasks", durationText)
 	}
+	return duration, nil
 }
 
-// Runs a command line task. Only allows one of the task to run at a time
-func runCustomCommand(command string) {
-	// Split the command up into the values so exec can find the right executable to run
-	commandVals := strings.Split(command, " ")
+// Units longer than an hour that time.ParseDuration doesn't support
+var longDurationUnits = map[string]time.Duration{
+	"d": 24 * time.Hour,
+	"w": 7 * 24 * time.Hour,
+}
 
-	var cmd *exec.Cmd
-	if len(commandVals) == 1 {
-		cmd = exec.Command(commandVals[0])
-	} else {
-		cmd = exec.Command(commandVals[0], commandVals[1:]...)
+// Parses a duration the same way as time.ParseDuration, but also allows days (d) and weeks (w), e.g. "1w2d3h".
+// The days and weeks are added up separately and everything else is left to the standard parser
+func parseDurationWithLongUnits(durationText string) (time.Duration, error) {
+	sign, rest := "", durationText
+	if strings.HasPrefix(rest, "-") || strings.HasPrefix(rest, "+") {
+		sign, rest = rest[:1], rest[1:]
+	}
+	if rest == "" {
+		return time.ParseDuration(durationText)
 	}
-	runAndLogTask(cmd, command)
+
+	isNumberChar := func(char rune) bool { return (char >= '0' && char <= '9') || char == '.' }
+	var longDuration time.Duration
+	var shortText strings.Builder
+	for rest != "" {
+		// Each part of the duration is a number followed by its unit
+		unitStart := strings.IndexFunc(rest, func(char rune) bool { return !isNumberChar(char) })
+		if unitStart == -1 {
+			unitStart = len(rest)
+		}
+		partEnd := strings.IndexFunc(rest[unitStart:], isNumberChar)
+		if partEnd == -1 {
+			partEnd = len(rest)
+		} else {
+			partEnd += unitStart
+		}
+
+		if unitLength, isLongUnit := longDurationUnits[rest[unitStart:partEnd]]; isLongUnit {
+			value, err := strconv.ParseFloat(rest[:unitStart], 64)
+			if err != nil {
+				return 0, fmt.Errorf("time: invalid duration \"%s\"", durationText)
+			}
+			longDuration += time.Duration(value * float64(unitLength))
+		} else {
+			shortText.WriteString(rest[:partEnd])
+		}
+		rest = rest[partEnd:]
+	}
+
+	duration := longDuration
+	if shortText.Len() > 0 {
+		shortDuration, err := time.ParseDuration(shortText.String())
+		if err != nil {
+			return 0, err
+		}
+		duration += shortDuration
+	}
+	if sign == "-" {
+		duration = -duration
+	}
+	return duration, nil
 }
 
-// Runs a bash file. Only allows one of the scripts to execute at a time
-func runBashFile(scriptPath string) {
-	cmd := exec.Command("/usr/bin/bash", scriptPath)
-	runAndLogTask(cmd, scriptPath)
+// Closes the log file, when logs are written to one rather than syslog
+func closeLogFile() {
+	if logFile != nil {
+		logFile.Close()
+	}
 }
 
-// Runs and logs a predefined user task or script
-func runAndLogTask(cmd *exec.Cmd, taskName string) {
+// The log file used when --logs isn't given, or when the one given can't be used
+const defaultLogPath = "./task-scheduler.log"
 
-	// Bind the output to a new buffer
-	var out bytes.Buffer
-	cmd.Stdout = &out
+// Sets up the system logger to use the file specified, rotating it once it reaches maxSize bytes if maxSize is set.
+// The file's directory is created if it doesn't exist yet
+func setupLogFile(logPath string, maxSize int64, maxBackups int) {
+	// A failure here shows up as the file failing to open below
+	os.MkdirAll(filepath.Dir(logPath), 0o755)
+	file, initialError := scheduler.OpenRotatingLogFile(logPath, maxSize, maxBackups)
+	if initialError != nil {
+		// Attempt to fallback to local logfile if possible
+		if filepath.Clean(logPath) == filepath.Clean(defaultLogPath) {
+			// Already using the default, can't continue
+			logFatal(initialError.Error())
+		}
+		// Not using the default, use fallback
+		scheduler.LogError(initialError.Error())
+		scheduler.LogWarning(fmt.Sprintf("An error occurred attempting to use a custom log file, falling back to %s", defaultLogPath))
+		defaultFile, err := scheduler.OpenRotatingLogFile(defaultLogPath, maxSize, maxBackups)
 
-	if err := cmd.Run(); err != nil {
-		// Task failed, print the failure to the logs and exit
-		log.Println(fmt.Sprintf("ERROR!:  %v", err))
-		return
+		if err != nil {
+			// Can't even fall back to default, can't continue
+			logFatal(err.Error())
+		}
+		// Reassign file
+		file = defaultFile
 	}
 
-	// Succeeded, print the response in a human readable log format
-	log.Println(fmt.Sprintf("%s - %s", taskName, out.String()))
+	// Use as logging output
+	logFile = file
+	scheduler.SetLogFile(logFile)
+	log.SetOutput(logFile)
 }
@@ -0,0 +1,389 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jt28828/go-shedule-tasks/scheduler"
+)
+
+// Writes a task file with the given content to a temp dir, returning its path
+func writeTaskFile(t *testing.T, content string) string {
+	t.Helper()
+	taskFilePath := filepath.Join(t.TempDir(), "tasks.txt")
+	if err := os.WriteFile(taskFilePath, []byte(content), 0o644); err != nil {
+		t.Fatalf("can't write the task file: %v", err)
+	}
+	return taskFilePath
+}
+
+func TestBuildTasksMixesFileAndFlagTasks(t *testing.T) {
+	taskFilePath := writeTaskFile(t, "echo file-one 2m\necho file-two 3h\n")
+
+	t.Run("pairs every task with its own duration", func(t *testing.T) {
+		sources := taskSources{
+			taskList:      stringMultiFlag{"echo flag-one", "echo flag-two"},
+			schedules:     scheduleList{{timeBetweenRuns: time.Minute}, {timeBetweenRuns: time.Hour}},
+			taskFilePaths: stringMultiFlag{taskFilePath},
+		}
+		tasks, err := sources.buildTasks()
+		if err != nil {
+			t.Fatalf("buildTasks failed: %v", err)
+		}
+
+		expected := []struct {
+			command  string
+			interval time.Duration
+		}{
+			{"echo flag-one", time.Minute},
+			{"echo flag-two", time.Hour},
+			{"echo file-one", 2 * time.Minute},
+			{"echo file-two", 3 * time.Hour},
+		}
+		if len(tasks) != len(expected) {
+			t.Fatalf("expected %d tasks, got %d", len(expected), len(tasks))
+		}
+		for i, want := range expected {
+			if tasks[i].Command != want.command || tasks[i].Interval != want.interval {
+				t.Errorf("task %d is %s every %v, expected %s every %v", i, tasks[i].Command, tasks[i].Interval, want.command, want.interval)
+			}
+		}
+	})
+
+	t.Run("names the flag task without a duration", func(t *testing.T) {
+		sources := taskSources{
+			taskList:      stringMultiFlag{"echo flag-one", "echo flag-two"},
+			schedules:     scheduleList{{timeBetweenRuns: time.Minute}},
+			taskFilePaths: stringMultiFlag{taskFilePath},
+		}
+		_, err := sources.buildTasks()
+		if err == nil {
+			t.Fatal("expected an error for the flag task without a duration")
+		}
+		if !strings.Contains(err.Error(), "\"echo flag-two\"") {
+			t.Errorf("expected the error to name \"echo flag-two\", got: %v", err)
+		}
+	})
+
+	t.Run("rejects durations left over after the file", func(t *testing.T) {
+		sources := taskSources{
+			taskList:      stringMultiFlag{"echo flag-one"},
+			schedules:     scheduleList{{timeBetweenRuns: time.Minute}, {timeBetweenRuns: time.Hour}},
+			taskFilePaths: stringMultiFlag{taskFilePath},
+		}
+		if _, err := sources.buildTasks(); err == nil {
+			t.Fatal("expected an error for the duration that doesn't belong to a flag task")
+		}
+	})
+}
+
+func TestBuildTasksNamesIntervalCopies(t *testing.T) {
+	for _, test := range []struct {
+		names    stringMultiFlag
+		expected []string
+	}{
+		{nil, []string{"", "./sync.sh-2", "./sync.sh-3", ""}},
+		{stringMultiFlag{"sync", "report"}, []string{"sync", "sync-2", "sync-3", "report"}},
+		// The copies share the index of the task they came from, and don't shift the index of the tasks after it
+		{stringMultiFlag{"sync-{{.Index}}", "report-{{.Index}}"}, []string{"sync-1", "sync-1-2", "sync-1-3", "report-2"}},
+	} {
+		sources := taskSources{
+			taskList: stringMultiFlag{"./sync.sh", "./report.sh"},
+			names:    test.names,
+			schedules: scheduleList{
+				{timeBetweenRuns: time.Hour, moreIntervals: []time.Duration{5 * time.Minute, 30 * time.Second}},
+				{timeBetweenRuns: time.Hour},
+			},
+		}
+		tasks, err := sources.buildTasks()
+		if err != nil {
+			t.Fatalf("buildTasks failed: %v", err)
+		}
+		if len(tasks) != len(test.expected) {
+			t.Fatalf("expected %d tasks, got %d", len(test.expected), len(tasks))
+		}
+		for i, name := range test.expected {
+			if tasks[i].Name != name {
+				t.Errorf("task %d is named %q, expected %q", i, tasks[i].Name, name)
+			}
+		}
+	}
+}
+
+func TestDurationMultiFlagSetRejectsBadDurations(t *testing.T) {
+	for _, value := range []string{"", "soon", "10", "5x", "-5m", "1h,", "1h,nope"} {
+		var schedules scheduleList
+		durations := durationMultiFlag{schedules: &schedules}
+		if err := durations.Set(value); err == nil {
+			t.Errorf("Set(%q) returned no error", value)
+		}
+		if len(schedules) != 0 {
+			t.Errorf("Set(%q) added %d schedules after failing", value, len(schedules))
+		}
+	}
+
+	var schedules scheduleList
+	durations := durationMultiFlag{schedules: &schedules}
+	if err := durations.Set("1h30m"); err != nil {
+		t.Fatalf("Set(\"1h30m\") failed: %v", err)
+	}
+	if len(schedules) != 1 || schedules[0].timeBetweenRuns != 90*time.Minute {
+		t.Errorf("Set(\"1h30m\") added %v, expected a single 1h30m schedule", schedules)
+	}
+}
+
+func TestParseDurationLongUnits(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected time.Duration
+	}{
+		{"1d", 24 * time.Hour},
+		{"2w", 14 * 24 * time.Hour},
+		{"1w3d", 10 * 24 * time.Hour},
+		{"1w2d3h", 9*24*time.Hour + 3*time.Hour},
+		{"1d12h30m", 36*time.Hour + 30*time.Minute},
+		{"1.5d", 36 * time.Hour},
+		{"3h1d", 27 * time.Hour},
+	}
+	for _, test := range tests {
+		duration, err := parseDuration(test.text)
+		if err != nil {
+			t.Errorf("parseDuration(%q) failed: %v", test.text, err)
+			continue
+		}
+		if duration != test.expected {
+			t.Errorf("parseDuration(%q) = %v, expected %v", test.text, duration, test.expected)
+		}
+	}
+
+	for _, text := range []string{"d", "w1", "1dw", "1d2", "1y", "1d 2h", "-1d", "1w-2d"} {
+		if duration, err := parseDuration(text); err == nil {
+			t.Errorf("parseDuration(%q) = %v, expected an error", text, duration)
+		}
+	}
+}
+
+func TestParseTasksFileSkipsCommentsAndBlankLines(t *testing.T) {
+	taskFilePath := writeTaskFile(t, "# Backups\n\necho backup 1h   \n   \n\t# indented comment\n  echo report 2m\t\n\n# the end\n")
+
+	tasks, schedules, disabled, err := parseTasksFile(taskFilePath)
+	if err != nil {
+		t.Fatalf("parseTasksFile failed: %v", err)
+	}
+	expectedTasks := []string{"echo backup", "echo report"}
+	expectedIntervals := []time.Duration{time.Hour, 2 * time.Minute}
+	if len(tasks) != len(expectedTasks) || len(schedules) != len(expectedTasks) || len(disabled) != len(expectedTasks) {
+		t.Fatalf("expected %d tasks, got tasks %q with %d schedules", len(expectedTasks), tasks, len(schedules))
+	}
+	for i := range expectedTasks {
+		if tasks[i] != expectedTasks[i] || schedules[i].timeBetweenRuns != expectedIntervals[i] || disabled[i] {
+			t.Errorf("task %d is %q every %v, expected %q every %v", i, tasks[i], schedules[i].timeBetweenRuns, expectedTasks[i], expectedIntervals[i])
+		}
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected time.Duration
+	}{
+		{"0", 0},
+		{"0s", 0},
+		{"90s", 90 * time.Second},
+		{"1h30m", 90 * time.Minute},
+		{"2h5m10s", 2*time.Hour + 5*time.Minute + 10*time.Second},
+		{"500ms", 500 * time.Millisecond},
+		{"1.5h", 90 * time.Minute},
+	}
+	for _, test := range tests {
+		duration, err := parseDuration(test.text)
+		if err != nil {
+			t.Errorf("parseDuration(%q) failed: %v", test.text, err)
+			continue
+		}
+		if duration != test.expected {
+			t.Errorf("parseDuration(%q) = %v, expected %v", test.text, duration, test.expected)
+		}
+	}
+
+	for _, text := range []string{"", "10", "h", "1x", "one hour", "1h30", "-1s", "-1h30m"} {
+		if duration, err := parseDuration(text); err == nil {
+			t.Errorf("parseDuration(%q) = %v, expected an error", text, duration)
+		}
+	}
+	if _, err := parseDuration("-5m"); err == nil || !strings.Contains(err.Error(), "negative") {
+		t.Errorf("expected a negative duration error, got %v", err)
+	}
+}
+
+func TestParseTaskFileRow(t *testing.T) {
+	tests := []struct {
+		row      string
+		command  string
+		schedule taskSchedule
+	}{
+		{"echo hello 5m", "echo hello", taskSchedule{timeBetweenRuns: 5 * time.Minute}},
+		{"/opt/backup.sh 1d", "/opt/backup.sh", taskSchedule{timeBetweenRuns: 24 * time.Hour}},
+		{"  ping -c 3 1.1.1.1\t2h  ", "ping -c 3 1.1.1.1", taskSchedule{timeBetweenRuns: 2 * time.Hour}},
+		{"`/opt/backup.sh --full now` 6h", "/opt/backup.sh --full now", taskSchedule{timeBetweenRuns: 6 * time.Hour}},
+		{"'echo a  b' 1m", "echo a  b", taskSchedule{timeBetweenRuns: time.Minute}},
+		// Double quotes are left for the same handling as tasks from flags
+		{"\"echo 1h\" 2h", "\"echo 1h\"", taskSchedule{timeBetweenRuns: 2 * time.Hour}},
+		// Quotes only open at the start of a word, and a quoted command can run straight into its duration
+		{"echo don't 5m", "echo don't", taskSchedule{timeBetweenRuns: 5 * time.Minute}},
+		{"`cmd`1h", "cmd", taskSchedule{timeBetweenRuns: time.Hour}},
+		{"./report.sh @09:00", "./report.sh", taskSchedule{cronSpec: "0 9 * * *"}},
+		{"./report.sh @7:05", "./report.sh", taskSchedule{cronSpec: "5 7 * * *"}},
+	}
+	for _, test := range tests {
+		command, schedule, err := parseTaskFileRow(test.row)
+		if err != nil {
+			t.Errorf("parseTaskFileRow(%q) failed: %v", test.row, err)
+			continue
+		}
+		if command != test.command || schedule.timeBetweenRuns != test.schedule.timeBetweenRuns || schedule.cronSpec != test.schedule.cronSpec {
+			t.Errorf("parseTaskFileRow(%q) = %q %v, expected %q %v", test.row, command, schedule, test.command, test.schedule)
+		}
+	}
+
+	for _, row := range []string{
+		// Missing or bad durations
+		"echo hello",
+		"echo hello soon",
+		"echo hello -5m",
+		"\"/opt/backup.sh 6h\"",
+		// Quotes that are never closed
+		"\"echo hello 5m",
+		"`echo hello 5m",
+		// Times of day that don't read one way
+		"./report.sh @9",
+		"./report.sh @0900",
+		"./report.sh @9:00pm",
+		"./report.sh @24:00",
+		"./report.sh @12:60",
+	} {
+		if command, schedule, err := parseTaskFileRow(row); err == nil {
+			t.Errorf("parseTaskFileRow(%q) = %q %v, expected an error", row, command, schedule)
+		}
+	}
+}
+
+func TestParseTasksFile(t *testing.T) {
+	t.Run("missing file", func(t *testing.T) {
+		if _, _, _, err := parseTasksFile(filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+			t.Fatal("expected an error for a task file that doesn't exist")
+		}
+	})
+
+	t.Run("keeps the valid rows around invalid ones", func(t *testing.T) {
+		taskFilePath := writeTaskFile(t, "echo one 1m\necho two soon\nnoduration\necho three 3m -enabled=false\necho four 4m -enabled=maybe\necho five 5m\n")
+		tasks, schedules, disabled, err := parseTasksFile(taskFilePath)
+		if err != nil {
+			t.Fatalf("parseTasksFile failed: %v", err)
+		}
+		expectedTasks := []string{"echo one", "echo three", "echo five"}
+		expectedIntervals := []time.Duration{time.Minute, 3 * time.Minute, 5 * time.Minute}
+		expectedDisabled := []bool{false, true, false}
+		if len(tasks) != len(expectedTasks) {
+			t.Fatalf("expected tasks %q, got %q", expectedTasks, tasks)
+		}
+		for i := range expectedTasks {
+			if tasks[i] != expectedTasks[i] || schedules[i].timeBetweenRuns != expectedIntervals[i] || disabled[i] != expectedDisabled[i] {
+				t.Errorf("task %d is %q every %v (disabled %t), expected %q every %v (disabled %t)", i, tasks[i], schedules[i].timeBetweenRuns, disabled[i], expectedTasks[i], expectedIntervals[i], expectedDisabled[i])
+			}
+		}
+	})
+
+	t.Run("returns the rows before a read error", func(t *testing.T) {
+		// Longer than the scanner's largest line, which stops it reading
+		taskFilePath := writeTaskFile(t, "echo before 1m\necho "+strings.Repeat("x", 70*1024)+" 1m\necho after 1m\n")
+		tasks, _, _, err := parseTasksFile(taskFilePath)
+		if err == nil {
+			t.Fatal("expected an error for the line that's too long to read")
+		}
+		if len(tasks) != 1 || tasks[0] != "echo before" {
+			t.Errorf("expected only the task before the error, got %q", tasks)
+		}
+	})
+}
+
+func TestSetupLogFileCreatesNestedDirectories(t *testing.T) {
+	defer log.SetOutput(os.Stderr)
+	logPath := filepath.Join(t.TempDir(), "logs", "nested", "deeper", "task-scheduler.log")
+
+	setupLogFile(logPath, 0, 0)
+	defer func() {
+		closeLogFile()
+		logFile = nil
+		scheduler.SetLogFile(nil)
+	}()
+	scheduler.LogInfo("written to the nested log file")
+
+	content, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatalf("the log file wasn't created in its nested directory: %v", err)
+	}
+	if !strings.Contains(string(content), "written to the nested log file") {
+		t.Errorf("expected the log line in %s, got %q", logPath, content)
+	}
+}
+
+func TestColorAlwaysDoesNotColourTheLogFile(t *testing.T) {
+	defer log.SetOutput(os.Stderr)
+	defer scheduler.SetLogColor(false)
+	logPath := filepath.Join(t.TempDir(), "task-scheduler.log")
+
+	// setupFromFlags defines its flags on the default flag set, so it's given a fresh one to parse the test's arguments
+	defer func(args []string, commandLine *flag.FlagSet) {
+		os.Args = args
+		flag.CommandLine = commandLine
+	}(os.Args, flag.CommandLine)
+	flag.CommandLine = flag.NewFlagSet("task-scheduler", flag.ContinueOnError)
+	os.Args = []string{"task-scheduler", "--color", "always", "--logs", logPath, "--task", "echo hello", "-d", "1h"}
+
+	setupFromFlags()
+	defer func() {
+		closeLogFile()
+		logFile = nil
+		scheduler.SetLogFile(nil)
+	}()
+	scheduler.LogError("written with --color always")
+
+	content, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatalf("can't read the log file: %v", err)
+	}
+	if !strings.Contains(string(content), "written with --color always") {
+		t.Fatalf("expected the log line in %s, got %q", logPath, content)
+	}
+	if strings.Contains(string(content), "\033[") {
+		t.Errorf("expected the log file to have no colour codes, got %q", content)
+	}
+}
+
+func TestSingleTokenTaskFileRows(t *testing.T) {
+	for _, row := range []string{"/opt/backup.sh", "5m", "`echo hello`", "\"echo hello\"", "@09:00"} {
+		command, schedule, err := parseTaskFileRow(row)
+		if err == nil {
+			t.Errorf("parseTaskFileRow(%q) = %q %v, expected an error", row, command, schedule)
+			continue
+		}
+		if !strings.Contains(err.Error(), "needs both a command and a duration") {
+			t.Errorf("parseTaskFileRow(%q) failed with %q, expected it to say a duration is missing", row, err)
+		}
+	}
+
+	// The rest of the file is still read
+	tasks, _, _, err := parseTasksFile(writeTaskFile(t, "/opt/backup.sh\necho hello 5m\n"))
+	if err != nil {
+		t.Fatalf("parseTasksFile failed: %v", err)
+	}
+	if len(tasks) != 1 || tasks[0] != "echo hello" {
+		t.Errorf("expected only the row with a duration, got %q", tasks)
+	}
+}
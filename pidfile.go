@@ -0,0 +1,70 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/jt28828/go-shedule-tasks/scheduler"
+)
+
+// Writes the --pidfile if there is one and makes sure a fatal error from then on removes it
+func writePidFileForRun() {
+	if pidFilePath == "" {
+		return
+	}
+	if err := writePidFile(pidFilePath); err != nil {
+		logFatal(err.Error())
+	}
+	fatalCleanups = append(fatalCleanups, func() { removePidFile(pidFilePath) })
+}
+
+// Writes the scheduler's PID to the pidfile so init systems can find it. Errors if the file names another scheduler
+// that's still running, a pidfile left behind by one that has stopped is replaced
+func writePidFile(pidFilePath string) error {
+	pid := os.Getpid()
+	for attempt := 0; attempt < 2; attempt++ {
+		// Created exclusively so two schedulers starting at once can't both think they own the file
+		file, err := os.OpenFile(pidFilePath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			_, err = file.WriteString(strconv.Itoa(pid) + "\n")
+			if closeErr := file.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				return fmt.Errorf("failed to write the pidfile %s: %v", pidFilePath, err)
+			}
+			scheduler.LogInfo(fmt.Sprintf("Wrote the scheduler's PID %d to %s", pid, pidFilePath))
+			return nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return fmt.Errorf("failed to create the pidfile %s: %v", pidFilePath, err)
+		}
+
+		contents, err := os.ReadFile(pidFilePath)
+		if err != nil {
+			return fmt.Errorf("failed to read the existing pidfile %s: %v", pidFilePath, err)
+		}
+		if existingPid, err := strconv.Atoi(strings.TrimSpace(string(contents))); err == nil && existingPid > 0 && existingPid != pid && processAlive(existingPid) {
+			return fmt.Errorf("the pidfile %s says the scheduler is already running as PID %d. Stop it first, or remove the file if that's not the scheduler", pidFilePath, existingPid)
+		}
+		scheduler.LogWarning(fmt.Sprintf("Replacing the pidfile %s left behind by a scheduler that's no longer running", pidFilePath))
+		if err := os.Remove(pidFilePath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to remove the old pidfile %s: %v", pidFilePath, err)
+		}
+	}
+	return fmt.Errorf("failed to create the pidfile %s, another scheduler keeps creating it", pidFilePath)
+}
+
+// Removes the pidfile on shutdown, as long as it still belongs to this scheduler
+func removePidFile(pidFilePath string) {
+	contents, err := os.ReadFile(pidFilePath)
+	if err != nil || strings.TrimSpace(string(contents)) != strconv.Itoa(os.Getpid()) {
+		return
+	}
+	if err := os.Remove(pidFilePath); err != nil {
+		scheduler.LogWarning(fmt.Sprintf("Failed to remove the pidfile %s. %v", pidFilePath, err))
+	}
+}
@@ -0,0 +1,16 @@
+//go:build windows
+
+package main
+
+import "os"
+
+// Checks whether a process with the given PID is running. Finding a process on Windows opens it, which fails once it
+// has exited
+func processAlive(pid int) bool {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	process.Release()
+	return true
+}
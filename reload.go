@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/jt28828/go-shedule-tasks/scheduler"
+)
+
+// The flags and files the tasks were built from, used to build them again on reload
+var sources taskSources
+
+// Stops a reload from SIGHUP and one from a file changing building the tasks at the same time
+var reloadMutex sync.Mutex
+
+// Reloads the task file and config file whenever the scheduler is sent SIGHUP. Returns once ctx is done
+func watchForReload(ctx context.Context) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	defer signal.Stop(signals)
+	for {
+		select {
+		case <-signals:
+			reloadTasks()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Reads the task file and config file again and hands the new task list to the scheduler, which starts, stops and
+// restarts only the tasks that were added, removed or changed
+func reloadTasks() {
+	reloadMutex.Lock()
+	defer reloadMutex.Unlock()
+
+	scheduler.LogInfo("Reloading tasks")
+	taskList, err := sources.buildTasks()
+	if err == nil {
+		err = taskScheduler.Reload(taskList)
+	}
+	if err != nil {
+		scheduler.LogError(fmt.Sprintf("Failed to reload tasks, keeping the current tasks. %v", err))
+	}
+}
+
+// Checks the task files and config file for changes every --reload-interval, reloading the tasks when their modtimes
+// change. Changes are only reloaded once the files have stopped changing for a whole interval, so an editor saving
+// several times in a row causes one reload. Returns once ctx is done
+func watchFilesForChanges(ctx context.Context) {
+	ticker := time.NewTicker(reloadInterval)
+	defer ticker.Stop()
+
+	lastModTimes := sourceModTimes()
+	changed := false
+	for {
+		select {
+		case <-ticker.C:
+			modTimes := sourceModTimes()
+			if !sameModTimes(modTimes, lastModTimes) {
+				lastModTimes = modTimes
+				changed = true
+				continue
+			}
+			if changed {
+				changed = false
+				scheduler.LogInfo("The task files or config file changed")
+				reloadTasks()
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// The last modified times of the task files and config file, by their paths. Files that can't be read (e.g. while
+// they're being replaced) have the zero time, so they count as changed once they're back. Stdin can't change so it's
+// left out
+func sourceModTimes() map[string]time.Time {
+	paths := append([]string{}, sources.taskFilePaths...)
+	if sources.configPath != "" {
+		paths = append(paths, sources.configPath)
+	}
+
+	modTimes := map[string]time.Time{}
+	for _, path := range paths {
+		if path == "-" {
+			continue
+		}
+		modTimes[path] = time.Time{}
+		if info, err := os.Stat(path); err == nil {
+			modTimes[path] = info.ModTime()
+		}
+	}
+	return modTimes
+}
+
+func sameModTimes(modTimes map[string]time.Time, others map[string]time.Time) bool {
+	for path, modTime := range modTimes {
+		if !modTime.Equal(others[path]) {
+			return false
+		}
+	}
+	return len(modTimes) == len(others)
+}
@@ -0,0 +1,171 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// A task as it's shown by the HTTP API
+type taskStatusResponse struct {
+	Name    string `json:"name"`
+	Command string `json:"command"`
+	// The interval, cron expression or run once time the task is scheduled with
+	Interval string `json:"interval"`
+	// Null until the task has run for the first time
+	LastRun    *string `json:"last_run"`
+	LastStatus *string `json:"last_status"`
+	Paused     bool    `json:"paused"`
+	// Always an object, empty when the task has no labels
+	Labels map[string]string `json:"labels"`
+}
+
+// The body of every response that isn't a list of tasks
+type apiMessageResponse struct {
+	Message string `json:"message"`
+}
+
+// Gives a task an id that none of the other tasks use and checks its name isn't taken. Tasks are known by their name,
+// or their command when they don't have one. Tasks that would share an id have a number added to the end
+// (e.g. "backup-2") so each can still be found
+func assignTaskID(task *scheduledTask, others []*scheduledTask) error {
+	used := map[string]bool{}
+	for _, other := range others {
+		if task.Name != "" && other.Name == task.Name {
+			return fmt.Errorf("The task name \"%s\" was given to more than one task. Every task name needs to be unique", task.Name)
+		}
+		used[other.id] = true
+	}
+
+	id := task.displayName()
+	for count := 2; used[id]; count++ {
+		id = fmt.Sprintf("%s-%d", task.displayName(), count)
+	}
+	task.id = id
+	return nil
+}
+
+// Finds a task by its id. Returns nil if there's no task with that id
+func (s *Scheduler) findTask(id string) *scheduledTask {
+	for _, task := range s.currentTasks() {
+		if task.id == id {
+			return task
+		}
+	}
+	return nil
+}
+
+// Returns a handler for the HTTP control API, for listing, running, pausing and resuming tasks
+func (s *Scheduler) APIHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /tasks", s.handleListTasks)
+	mux.HandleFunc("GET /tasks/{name}/logs", s.handleTaskLogs)
+	mux.HandleFunc("POST /tasks/{name}/run", s.handleRunTask)
+	mux.HandleFunc("POST /tasks/{name}/pause", s.handlePauseTask)
+	mux.HandleFunc("POST /tasks/{name}/resume", s.handleResumeTask)
+	return mux
+}
+
+// Lists every task along with its schedule and how its last run went. Tasks can be filtered by their labels with tag
+// parameters, ?tag=team:infra for tasks with that label value or ?tag=team for tasks with the label at all. Given more
+// than once, tasks need to match every tag
+func (s *Scheduler) handleListTasks(writer http.ResponseWriter, request *http.Request) {
+	tags := request.URL.Query()["tag"]
+	statuses := s.Tasks()
+	response := make([]taskStatusResponse, 0, len(statuses))
+	for _, status := range statuses {
+		if !matchesTags(status.Task.Labels, tags) {
+			continue
+		}
+		taskResponse := taskStatusResponse{
+			Name:     status.ID,
+			Command:  status.Task.Command,
+			Interval: status.Schedule,
+			Paused:   status.Paused,
+			Labels:   status.Task.Labels,
+		}
+		if taskResponse.Labels == nil {
+			taskResponse.Labels = map[string]string{}
+		}
+		if !status.LastRun.IsZero() {
+			lastRun := status.LastRun.Format(time.RFC3339)
+			lastStatus := status.LastStatus
+			taskResponse.LastRun = &lastRun
+			taskResponse.LastStatus = &lastStatus
+		}
+		response = append(response, taskResponse)
+	}
+	writeJSONResponse(writer, http.StatusOK, response)
+}
+
+// Whether a task's labels match every tag, given as name:value or just a name
+func matchesTags(labels map[string]string, tags []string) bool {
+	for _, tag := range tags {
+		name, value, hasValue := strings.Cut(tag, ":")
+		labelValue, hasLabel := labels[name]
+		if !hasLabel || (hasValue && labelValue != value) {
+			return false
+		}
+	}
+	return true
+}
+
+// Runs a task straight away, outside of its schedule. Runs even if the task is paused
+func (s *Scheduler) handleRunTask(writer http.ResponseWriter, request *http.Request) {
+	task := s.findTask(request.PathValue("name"))
+	if task == nil {
+		writeTaskNotFound(writer, request)
+		return
+	}
+	if task.Disabled {
+		writeJSONResponse(writer, http.StatusConflict, apiMessageResponse{Message: fmt.Sprintf("%s is disabled", task.id)})
+		return
+	}
+
+	logTaskMessage(levelInfo, task.displayName(), fmt.Sprintf("%s was triggered through the HTTP API", task.displayName()))
+	// Goes through runTask so it follows the task's overlap mode like any scheduled run
+	s.startRun(func() { s.runTask(task) })
+	writeJSONResponse(writer, http.StatusAccepted, apiMessageResponse{Message: fmt.Sprintf("%s has been started", task.id)})
+}
+
+// Stops a task's scheduled runs until it's resumed
+func (s *Scheduler) handlePauseTask(writer http.ResponseWriter, request *http.Request) {
+	task := s.findTask(request.PathValue("name"))
+	if task == nil {
+		writeTaskNotFound(writer, request)
+		return
+	}
+
+	task.setPaused(true)
+	logTaskMessage(levelInfo, task.displayName(), fmt.Sprintf("%s was paused through the HTTP API", task.displayName()))
+	writeJSONResponse(writer, http.StatusOK, apiMessageResponse{Message: fmt.Sprintf("%s has been paused", task.id)})
+}
+
+// Lets a paused task carry on running on its schedule
+func (s *Scheduler) handleResumeTask(writer http.ResponseWriter, request *http.Request) {
+	task := s.findTask(request.PathValue("name"))
+	if task == nil {
+		writeTaskNotFound(writer, request)
+		return
+	}
+
+	task.setPaused(false)
+	logTaskMessage(levelInfo, task.displayName(), fmt.Sprintf("%s was resumed through the HTTP API", task.displayName()))
+	writeJSONResponse(writer, http.StatusOK, apiMessageResponse{Message: fmt.Sprintf("%s has been resumed", task.id)})
+}
+
+func writeTaskNotFound(writer http.ResponseWriter, request *http.Request) {
+	writeJSONResponse(writer, http.StatusNotFound, apiMessageResponse{Message: fmt.Sprintf("no task named \"%s\"", request.PathValue("name"))})
+}
+
+func writeJSONResponse(writer http.ResponseWriter, statusCode int, body interface{}) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(statusCode)
+	encoder := json.NewEncoder(writer)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(body); err != nil {
+		LogError(fmt.Sprintf("Failed to write an HTTP API response. %v", err))
+	}
+}
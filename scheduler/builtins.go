@@ -0,0 +1,148 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"time"
+)
+
+// A task built into the scheduler, run by giving its name as a task's command (e.g. @rotate-logs) instead of starting
+// a program, for housekeeping that would otherwise need cron alongside the scheduler
+type builtinTask struct {
+	// Does the task's work, returning what to log as the run's output or an error to fail the run
+	run func(s *Scheduler) (string, error)
+	// Why the task can't run in this scheduler, checked by CheckRunnable. Nil means it always can
+	check func(s *Scheduler) error
+}
+
+// Every built-in task by the command that runs it. Built-in commands all start with @
+var builtinTasks = map[string]builtinTask{
+	"@rotate-logs": {run: rotateLogsBuiltin},
+	"@gc":          {run: collectGarbageBuiltin},
+	"@state-save":  {run: saveStateBuiltin, check: checkStateSaveBuiltin},
+}
+
+// Whether a command names a built-in task rather than a program to run
+func isBuiltinCommand(command string) bool {
+	return strings.HasPrefix(strings.TrimSpace(command), "@")
+}
+
+// Finds the built-in task a command names, erroring with the built-in tasks there are if it doesn't name one
+func lookupBuiltinTask(command string) (builtinTask, error) {
+	builtin, exists := builtinTasks[strings.TrimSpace(command)]
+	if !exists {
+		var names []string
+		for name := range builtinTasks {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return builtinTask{}, fmt.Errorf("%s isn't a built-in task, expected one of %s", strings.TrimSpace(command), strings.Join(names, ", "))
+	}
+	return builtin, nil
+}
+
+// Runs a built-in task in the scheduler itself, logging how it went the same way as a command
+func (s *Scheduler) runBuiltinTask(task *scheduledTask) error {
+	taskName := task.displayName()
+
+	if task.Verbosity == VerbosityVerbose {
+		logTaskMessage(levelInfo, taskName, fmt.Sprintf("task=%s - Running the built-in task %s", taskName, strings.TrimSpace(task.Command)))
+	}
+	s.metrics.runStarted(task.id, taskName, task.Labels)
+	startTime := time.Now()
+	output, err := task.builtin.run(s)
+	if err != nil {
+		err = &runFailedError{err: err}
+	}
+	elapsed := time.Since(startTime)
+	s.metrics.runFinished(task.id, elapsed, err == nil)
+	task.recordHistory(newRunRecord(startTime, elapsed, false, err, output, ""), s.options.HistorySize)
+	durationMs := elapsed.Milliseconds()
+	duration := formatRunDuration(elapsed)
+
+	entry := logEntry{Task: taskName, DurationMs: &durationMs, Stdout: output}
+	if err != nil {
+		entry.Level = levelError
+		entry.Message = fmt.Sprintf("Task failed: %v", err)
+		writeTaskLog(task, entry, fmt.Sprintf("ERROR!: task=%s duration=%s - %v", taskName, duration, err))
+		return err
+	}
+
+	if task.Verbosity == VerbosityQuiet {
+		return nil
+	}
+	entry.Level = levelInfo
+	entry.Message = "Task succeeded"
+	writeTaskLog(task, entry, fmt.Sprintf("%s duration=%s - %s", taskName, duration, output))
+	return nil
+}
+
+// Rotates the main log file and every task's own log file straight away, the same way they rotate once they reach
+// their max size, for rotating on a schedule instead of by size
+func rotateLogsBuiltin(s *Scheduler) (string, error) {
+	var errs []error
+	rotated := 0
+	if mainLogFile != nil {
+		if err := mainLogFile.Rotate(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to rotate the log file: %v", err))
+		} else {
+			rotated++
+		}
+	}
+	for _, task := range s.currentTasks() {
+		if task.outputLogFile == nil {
+			continue
+		}
+		if err := task.outputLogFile.Rotate(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to rotate the log file for %s: %v", task.id, err))
+		} else {
+			rotated++
+		}
+	}
+	if rotated == 0 && len(errs) == 0 {
+		// Logging to syslog or stderr without a task log directory
+		return "There are no log files to rotate, the scheduler isn't logging to a file and has no task log directory", nil
+	}
+	return fmt.Sprintf("Rotated %d log file(s)", rotated), errors.Join(errs...)
+}
+
+// Runs the garbage collector and returns as much memory as it can to the OS, for long running schedulers on hosts
+// short on memory
+func collectGarbageBuiltin(s *Scheduler) (string, error) {
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	debug.FreeOSMemory()
+	runtime.ReadMemStats(&after)
+
+	freed := int64(before.HeapInuse) - int64(after.HeapInuse)
+	if freed < 0 {
+		// Other goroutines allocated more than was collected
+		freed = 0
+	}
+	return fmt.Sprintf("Freed %.1fMB, the heap is now %.1fMB", float64(freed)/(1024*1024), float64(after.HeapInuse)/(1024*1024)), nil
+}
+
+// Saves the state file from what's in memory, to write it back if it has been removed or changed since the last
+// successful run saved it
+func saveStateBuiltin(s *Scheduler) (string, error) {
+	if err := checkStateSaveBuiltin(s); err != nil {
+		// Only checked up front when the task's been through CheckRunnable
+		return "", err
+	}
+	if err := s.stateFile.saveNow(); err != nil {
+		return "", fmt.Errorf("failed to save the state file %s. %v", s.options.StateFile, err)
+	}
+	return fmt.Sprintf("Saved the state file %s", s.options.StateFile), nil
+}
+
+// @state-save has nothing to save without a state file
+func checkStateSaveBuiltin(s *Scheduler) error {
+	if s.stateFile == nil {
+		return fmt.Errorf("there's no state file to save. Pass one with --state-file")
+	}
+	return nil
+}
@@ -0,0 +1,263 @@
+package scheduler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A parsed cron expression. Each field is stored as a bitset of the values it allows
+type cronSchedule struct {
+	// Five field expressions only run on the first second of the minute
+	second     uint64
+	minute     uint64
+	hour       uint64
+	dayOfMonth uint64
+	month      uint64
+	dayOfWeek  uint64
+	// Cron runs a task if either day field matches when both are restricted, so track which ones were left as *
+	dayOfMonthAny bool
+	dayOfWeekAny  bool
+}
+
+// The allowed range of values for a single cron field along with any names that can be used instead of numbers
+type cronFieldRange struct {
+	name  string
+	min   int
+	max   int
+	names map[string]int
+}
+
+var (
+	secondRange     = cronFieldRange{name: "second", min: 0, max: 59}
+	minuteRange     = cronFieldRange{name: "minute", min: 0, max: 59}
+	hourRange       = cronFieldRange{name: "hour", min: 0, max: 23}
+	dayOfMonthRange = cronFieldRange{name: "day of month", min: 1, max: 31}
+	monthRange      = cronFieldRange{name: "month", min: 1, max: 12, names: map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	// Sunday can be written as either 0 or 7
+	dayOfWeekRange = cronFieldRange{name: "day of week", min: 0, max: 7, names: map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+// Shorthand expressions supported by most cron implementations
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// Describes the fields a cron expression can have, for error messages
+const cronFieldsHelp = "Expected 5 fields (minute hour day-of-month month day-of-week), or 6 with seconds first"
+
+// Checks a cron expression is a valid five field cron expression (minute hour day-of-month month day-of-week), a six
+// field one with seconds first or one of the shorthands like @daily
+func ValidateCron(cronText string) error {
+	if _, err := parseCronSpec(cronText); err != nil {
+		return fmt.Errorf("%v. %s", err, cronFieldsHelp)
+	}
+	return nil
+}
+
+// Parses a standard five field cron expression (minute hour day-of-month month day-of-week), or a six field one with
+// an extra seconds field at the start
+func parseCronSpec(cronText string) (*cronSchedule, error) {
+	spec := strings.TrimSpace(cronText)
+	if macro, ok := cronMacros[strings.ToLower(spec)]; ok {
+		spec = macro
+	}
+
+	fields := strings.Fields(spec)
+	schedule := &cronSchedule{second: 1}
+	var err error
+	switch len(fields) {
+	case 5:
+	case 6:
+		if schedule.second, err = parseCronField(fields[0], secondRange); err != nil {
+			return nil, err
+		}
+		fields = fields[1:]
+	default:
+		return nil, fmt.Errorf("cron expression \"%s\" has %d fields", cronText, len(fields))
+	}
+
+	if schedule.minute, err = parseCronField(fields[0], minuteRange); err != nil {
+		return nil, err
+	}
+	if schedule.hour, err = parseCronField(fields[1], hourRange); err != nil {
+		return nil, err
+	}
+	if schedule.dayOfMonth, err = parseCronField(fields[2], dayOfMonthRange); err != nil {
+		return nil, err
+	}
+	if schedule.month, err = parseCronField(fields[3], monthRange); err != nil {
+		return nil, err
+	}
+	if schedule.dayOfWeek, err = parseCronField(fields[4], dayOfWeekRange); err != nil {
+		return nil, err
+	}
+
+	// Fold 7 back onto 0 so Sunday only needs to be checked once
+	if schedule.dayOfWeek&(1<<7) != 0 {
+		schedule.dayOfWeek |= 1
+	}
+
+	schedule.dayOfMonthAny = strings.HasPrefix(fields[2], "*")
+	schedule.dayOfWeekAny = strings.HasPrefix(fields[4], "*")
+
+	return schedule, nil
+}
+
+// Parses a single cron field made up of comma separated values, ranges and steps (e.g. "1-5,*/15") into a bitset
+func parseCronField(field string, valueRange cronFieldRange) (uint64, error) {
+	var bits uint64
+
+	for _, part := range strings.Split(field, ",") {
+		rangeText, stepText := part, ""
+		if slashIndex := strings.Index(part, "/"); slashIndex != -1 {
+			rangeText, stepText = part[:slashIndex], part[slashIndex+1:]
+		}
+
+		step := 1
+		if stepText != "" {
+			parsedStep, err := strconv.Atoi(stepText)
+			if err != nil || parsedStep <= 0 {
+				return 0, fmt.Errorf("invalid step \"%s\" in %s field", stepText, valueRange.name)
+			}
+			step = parsedStep
+		}
+
+		var start, end int
+		switch {
+		case rangeText == "*":
+			start, end = valueRange.min, valueRange.max
+		case strings.Contains(rangeText, "-"):
+			bounds := strings.SplitN(rangeText, "-", 2)
+			var err error
+			if start, err = parseCronValue(bounds[0], valueRange); err != nil {
+				return 0, err
+			}
+			if end, err = parseCronValue(bounds[1], valueRange); err != nil {
+				return 0, err
+			}
+			if start > end {
+				return 0, fmt.Errorf("range \"%s\" in %s field starts after it ends", rangeText, valueRange.name)
+			}
+		default:
+			value, err := parseCronValue(rangeText, valueRange)
+			if err != nil {
+				return 0, err
+			}
+			start, end = value, value
+			// A single value with a step (e.g. "5/10") runs from that value to the end of the range
+			if stepText != "" {
+				end = valueRange.max
+			}
+		}
+
+		for value := start; value <= end; value += step {
+			bits |= 1 << uint(value)
+		}
+	}
+
+	return bits, nil
+}
+
+// Parses a single number or name for a cron field, ensuring it sits within the field's range
+func parseCronValue(valueText string, valueRange cronFieldRange) (int, error) {
+	if value, ok := valueRange.names[strings.ToLower(valueText)]; ok {
+		return value, nil
+	}
+
+	value, err := strconv.Atoi(valueText)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value \"%s\" in %s field", valueText, valueRange.name)
+	}
+	if value < valueRange.min || value > valueRange.max {
+		return 0, fmt.Errorf("value %d in %s field is outside the range %d-%d", value, valueRange.name, valueRange.min, valueRange.max)
+	}
+	return value, nil
+}
+
+// Finds the next time after the given time that matches the cron expression, in the given time's location.
+// Times are matched by the wall clock, so across daylight saving changes a time that's skipped (e.g. 2:30am when the
+// clocks go forward) runs as the clocks jump instead, and a time that happens twice only runs once.
+// Returns a zero time if nothing matches within the next 5 years (e.g. "0 0 30 2 *")
+func (c *cronSchedule) next(after time.Time) time.Time {
+	// Cron only works to the second, so start at the beginning of the next second
+	start := after.Add(time.Second - time.Duration(after.Nanosecond()))
+	location := after.Location()
+	yearLimit := start.Year() + 5
+
+	year, month, day := start.Date()
+	for year <= yearLimit {
+		// Normalises days past the end of the month into the next month
+		date := time.Date(year, month, day, 12, 0, 0, 0, location)
+		year, month, day = date.Date()
+
+		if c.month&(1<<uint(month)) == 0 {
+			month, day = month+1, 1
+			continue
+		}
+		if !c.dayMatches(date) {
+			day++
+			continue
+		}
+
+		for hour := 0; hour < 24; hour++ {
+			if c.hour&(1<<uint(hour)) == 0 {
+				continue
+			}
+			for minute := 0; minute < 60; minute++ {
+				if c.minute&(1<<uint(minute)) == 0 {
+					continue
+				}
+				for second := 0; second < 60; second++ {
+					if c.second&(1<<uint(second)) == 0 {
+						continue
+					}
+					candidate := time.Date(year, month, day, hour, minute, second, 0, location)
+					if candidate.Hour() != hour || candidate.Minute() != minute {
+						candidate = daylightSavingJump(candidate, hour*60+minute)
+					}
+					if !candidate.Before(start) {
+						return candidate
+					}
+				}
+			}
+		}
+		day++
+	}
+
+	return time.Time{}
+}
+
+// Finds when the clocks jumped forward over a wall clock time that doesn't exist. The time given is where Go placed the
+// missing time, which can be on either side of the jump
+func daylightSavingJump(placed time.Time, wantedMinuteOfDay int) time.Time {
+	zoneStart, zoneEnd := placed.ZoneBounds()
+	if placed.Hour()*60+placed.Minute() < wantedMinuteOfDay {
+		// Placed before the jump, so the jump is when this zone ends
+		return zoneEnd
+	}
+	return zoneStart
+}
+
+// Checks the day of month and day of week fields. When both are restricted cron runs on either matching
+func (c *cronSchedule) dayMatches(t time.Time) bool {
+	dayOfMonthMatch := c.dayOfMonth&(1<<uint(t.Day())) != 0
+	dayOfWeekMatch := c.dayOfWeek&(1<<uint(t.Weekday())) != 0
+
+	if c.dayOfMonthAny || c.dayOfWeekAny {
+		return dayOfMonthMatch && dayOfWeekMatch
+	}
+	return dayOfMonthMatch || dayOfWeekMatch
+}
@@ -0,0 +1,83 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronNext(t *testing.T) {
+	at := func(text string) time.Time {
+		parsed, err := time.Parse("2006-01-02 15:04:05", text)
+		if err != nil {
+			t.Fatalf("bad test time %s: %v", text, err)
+		}
+		return parsed
+	}
+
+	tests := []struct {
+		spec     string
+		after    string
+		expected string
+	}{
+		{"*/15 * * * *", "2024-01-01 00:07:00", "2024-01-01 00:15:00"},
+		// Strictly after, so a time that matches moves on to the next one
+		{"0 0 * * *", "2024-01-02 00:00:00", "2024-01-03 00:00:00"},
+		{"0 9 * * 1-5", "2024-01-06 10:00:00", "2024-01-08 09:00:00"},
+		{"0 9 * * mon-fri", "2024-01-06 10:00:00", "2024-01-08 09:00:00"},
+		{"30 * * * * *", "2024-01-01 00:00:00", "2024-01-01 00:00:30"},
+		{"@daily", "2024-01-01 12:00:00", "2024-01-02 00:00:00"},
+		{"@HOURLY", "2024-01-01 12:30:00", "2024-01-01 13:00:00"},
+		{"5/20 * * * *", "2024-01-01 00:26:00", "2024-01-01 00:45:00"},
+		{"0 0 1,15 * *", "2024-01-02 00:00:00", "2024-01-15 00:00:00"},
+		{"0 0 1 jun *", "2024-01-01 00:00:00", "2024-06-01 00:00:00"},
+		// Sunday can be 0 or 7
+		{"0 0 * * 7", "2024-01-01 00:00:00", "2024-01-07 00:00:00"},
+		// Both day fields restricted runs on either
+		{"0 0 1 * sun", "2024-01-02 00:00:00", "2024-01-07 00:00:00"},
+		{"0 0 29 2 *", "2024-03-01 00:00:00", "2028-02-29 00:00:00"},
+	}
+	for _, test := range tests {
+		schedule, err := parseCronSpec(test.spec)
+		if err != nil {
+			t.Errorf("parseCronSpec(%q) failed: %v", test.spec, err)
+			continue
+		}
+		if next := schedule.next(at(test.after)); !next.Equal(at(test.expected)) {
+			t.Errorf("%q after %s ran at %s, expected %s", test.spec, test.after, next, test.expected)
+		}
+	}
+}
+
+func TestCronNextNeverMatching(t *testing.T) {
+	schedule, err := parseCronSpec("0 0 30 2 *")
+	if err != nil {
+		t.Fatalf("parseCronSpec failed: %v", err)
+	}
+	if next := schedule.next(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)); !next.IsZero() {
+		t.Errorf("expected no next run for February 30th, got %s", next)
+	}
+}
+
+func TestParseCronSpecRejectsInvalidExpressions(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"* * * *",
+		"* * * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * 32 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"a * * * *",
+		"5-1 * * * *",
+		"* * * foo *",
+		"@weekdays",
+	} {
+		if _, err := parseCronSpec(spec); err == nil {
+			t.Errorf("parseCronSpec(%q) returned no error", spec)
+		}
+	}
+}
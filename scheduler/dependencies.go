@@ -0,0 +1,74 @@
+package scheduler
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Checks every task's prerequisite is another task in the scheduler and no tasks depend on each other in a loop,
+// which would stop all of them from ever running
+func (s *Scheduler) CheckDependencies() error {
+	return checkDependencies(s.currentTasks())
+}
+
+// Checks the prerequisites of a list of tasks against each other. Tasks are looked up by their id
+func checkDependencies(tasks []*scheduledTask) error {
+	tasksByID := map[string]*scheduledTask{}
+	for _, task := range tasks {
+		tasksByID[task.id] = task
+	}
+
+	for _, task := range tasks {
+		if task.After == "" {
+			continue
+		}
+		if _, exists := tasksByID[task.After]; !exists {
+			return fmt.Errorf("%s runs after %s, but there's no task with that name", task.id, task.After)
+		}
+
+		// Every task has at most one prerequisite, so following them either ends or comes back around to a task
+		// that was already visited
+		chain := []string{task.id}
+		visited := map[string]bool{task.id: true}
+		for next := tasksByID[task.After]; next != nil; next = tasksByID[next.After] {
+			chain = append(chain, next.id)
+			if next.id == task.id {
+				return fmt.Errorf("the tasks depend on each other in a loop: %s", strings.Join(chain, " -> "))
+			}
+			if visited[next.id] {
+				// A loop that doesn't include this task, reported when its own tasks are checked
+				break
+			}
+			visited[next.id] = true
+		}
+	}
+	return nil
+}
+
+// Whether a task's prerequisite has succeeded on its most recent run, so the task can run. Logs why the run is being
+// skipped when it can't. Tasks without a prerequisite can always run
+func (s *Scheduler) prerequisiteSucceeded(task *scheduledTask) bool {
+	if task.After == "" {
+		return true
+	}
+
+	prerequisite := s.findTask(task.After)
+	if prerequisite == nil {
+		logTaskMessage(levelError, task.displayName(), fmt.Sprintf("%s runs after %s, which isn't a task anymore. Skipping this run", task.displayName(), task.After))
+		return false
+	}
+
+	var reason string
+	switch prerequisite.status().LastStatus {
+	case StatusSuccess:
+		return true
+	case StatusFailure:
+		reason = "its last run failed"
+	case StatusRunning:
+		reason = "it's still running"
+	default:
+		reason = "it hasn't run yet"
+	}
+	logTaskMessage(levelWarning, task.displayName(), fmt.Sprintf("%s runs after %s, but %s. Skipping this run", task.displayName(), task.After, reason))
+	return false
+}
@@ -0,0 +1,100 @@
+package scheduler
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Reads the env vars (KEY=VALUE) from a dotenv file. Blank lines and lines starting with # are ignored, and a line can
+// start with "export " so the file can also be sourced by a shell. Values can be wrapped in single quotes, kept as
+// written, or double quotes, where \n, \t, \" and \\ are unescaped. Unquoted values end at a " #" comment
+func readEnvFile(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't open the env file %s. %v", path, err)
+	}
+	defer file.Close()
+
+	var env []string
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, err := parseEnvFileLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d of the env file %s %v", lineNumber, path, err)
+		}
+		env = append(env, key+"="+value)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("couldn't read the env file %s. %v", path, err)
+	}
+	return env, nil
+}
+
+// Splits a line of a dotenv file into its key and unquoted value
+func parseEnvFileLine(line string) (string, string, error) {
+	line = strings.TrimPrefix(line, "export ")
+	key, value, found := strings.Cut(line, "=")
+	key = strings.TrimSpace(key)
+	if !found {
+		return "", "", fmt.Errorf("should be KEY=VALUE")
+	}
+	if !isEnvFileKey(key) {
+		return "", "", fmt.Errorf("has \"%s\" as its key, only letters, numbers and underscores can be used", key)
+	}
+	value = strings.TrimSpace(value)
+
+	if value == "" || (value[0] != '"' && value[0] != '\'') {
+		if commentStart := strings.Index(value, " #"); commentStart != -1 {
+			value = strings.TrimSpace(value[:commentStart])
+		}
+		return key, value, nil
+	}
+
+	quote := value[0]
+	var unquoted strings.Builder
+	for i := 1; i < len(value); i++ {
+		char := value[i]
+		if char == quote {
+			rest := strings.TrimSpace(value[i+1:])
+			if rest != "" && !strings.HasPrefix(rest, "#") {
+				return "", "", fmt.Errorf("has text after the closing quote of %s", key)
+			}
+			return key, unquoted.String(), nil
+		}
+		if quote == '"' && char == '\\' && i+1 < len(value) {
+			i++
+			switch value[i] {
+			case 'n':
+				unquoted.WriteByte('\n')
+			case 't':
+				unquoted.WriteByte('\t')
+			default:
+				unquoted.WriteByte(value[i])
+			}
+			continue
+		}
+		unquoted.WriteByte(char)
+	}
+	return "", "", fmt.Errorf("is missing the closing quote of %s", key)
+}
+
+// Whether a key can be used as an env var name, letters, numbers and underscores not starting with a number
+func isEnvFileKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	for i, char := range key {
+		isLetter := (char >= 'a' && char <= 'z') || (char >= 'A' && char <= 'Z') || char == '_'
+		isNumber := char >= '0' && char <= '9'
+		if !isLetter && !(isNumber && i > 0) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,80 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Runs a task's guard command before a run, returning whether the run should go ahead. A guard that exits with a
+// failure skips the run, as does one that can't start or runs longer than the task's timeout. Tasks without a guard
+// always run
+func (s *Scheduler) guardAllows(task *scheduledTask) bool {
+	if task.Guard == "" {
+		return true
+	}
+	taskName := task.displayName()
+
+	ctx := s.runContext
+	if task.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, task.Timeout)
+		defer cancel()
+	}
+
+	var cmd *exec.Cmd
+	if s.options.UseShell {
+		shell, err := commandShell(s.options.Shell)
+		if err != nil {
+			logTaskMessage(levelError, taskName, fmt.Sprintf("The guard of %s couldn't be run. Skipping this run. %v", taskName, err))
+			return false
+		}
+		cmd = exec.CommandContext(ctx, shell[0], append(shell[1:], task.Guard)...)
+	} else {
+		program, args := parseCommandLine(task.Guard)
+		cmd = exec.CommandContext(ctx, program, args...)
+	}
+	// Run the same way as the task itself, so the guard checks what the task would see
+	cmd.Dir = task.WorkingDir
+	env, err := taskEnv(task)
+	if err != nil {
+		logTaskMessage(levelError, taskName, fmt.Sprintf("The env file of %s couldn't be loaded for its guard. Skipping this run. %v", taskName, err))
+		return false
+	}
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	killProcessGroupOnCancel(cmd)
+	if task.credential != nil {
+		setRunAs(cmd, task.credential)
+	}
+
+	output, err := cmd.CombinedOutput()
+	if err == nil {
+		if task.Verbosity == VerbosityVerbose {
+			logTaskMessage(levelInfo, taskName, fmt.Sprintf("task=%s - The guard %s passed", taskName, task.Guard))
+		}
+		return true
+	}
+
+	if s.runContext.Err() != nil {
+		// The scheduler is stopping, which already says why the run didn't happen
+		return false
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		logTaskMessage(levelWarning, taskName, fmt.Sprintf("task=%s skipped - The guard %s ran longer than the timeout of %v and was killed. Skipping this run", taskName, task.Guard, task.Timeout))
+		return false
+	}
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		logTaskMessage(levelError, taskName, fmt.Sprintf("task=%s skipped - The guard %s failed to start. Skipping this run. %v", taskName, task.Guard, err))
+		return false
+	}
+	if task.Verbosity != VerbosityQuiet {
+		logTaskMessage(levelInfo, taskName, fmt.Sprintf("task=%s skipped exit_code=%d - The guard %s didn't pass. Skipping this run. output: %s", taskName, exitErr.ExitCode(), task.Guard, strings.TrimSpace(string(output))))
+	}
+	return false
+}
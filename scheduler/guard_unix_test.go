@@ -0,0 +1,36 @@
+//go:build !windows
+
+package scheduler
+
+import (
+	"context"
+	"log"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestGuardGetsTheEnvFile(t *testing.T) {
+	logs := &syncBuffer{}
+	log.SetOutput(logs)
+	defer log.SetOutput(os.Stderr)
+
+	envFile := t.TempDir() + "/guard.env"
+	if err := os.WriteFile(envFile, []byte("GUARD_ALLOWS=yes\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	taskScheduler, err := New(Options{UseShell: true})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	err = taskScheduler.AddTask(Task{Name: "guarded", Command: "true", Interval: time.Hour, EnvFile: envFile, Guard: `test "$GUARD_ALLOWS" = yes`})
+	if err != nil {
+		t.Fatalf("AddTask failed: %v", err)
+	}
+	task := taskScheduler.currentTasks()[0]
+	taskScheduler.runContext = context.Background()
+
+	if !taskScheduler.guardAllows(task) {
+		t.Errorf("expected the guard to see the env file's vars and pass, got:\n%s", logs.String())
+	}
+}
@@ -0,0 +1,52 @@
+package scheduler
+
+import (
+	"net/http"
+)
+
+// Returns a handler for liveness and readiness probes. GET /healthz is healthy while the scheduler is running, and
+// GET /readyz is ready once every task the scheduler was started with is waiting for its first run. Neither depends on
+// how any task's runs have gone
+func (s *Scheduler) HealthHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", s.handleHealthz)
+	mux.HandleFunc("GET /readyz", s.handleReadyz)
+	return mux
+}
+
+// Healthy from when the scheduler is started until it's stopped
+func (s *Scheduler) handleHealthz(writer http.ResponseWriter, request *http.Request) {
+	if !s.isRunning() {
+		writeJSONResponse(writer, http.StatusServiceUnavailable, apiMessageResponse{Message: "The scheduler isn't running"})
+		return
+	}
+	writeJSONResponse(writer, http.StatusOK, apiMessageResponse{Message: "ok"})
+}
+
+// Ready once the scheduler is running and every task it was started with has been scheduled
+func (s *Scheduler) handleReadyz(writer http.ResponseWriter, request *http.Request) {
+	if !s.isRunning() {
+		writeJSONResponse(writer, http.StatusServiceUnavailable, apiMessageResponse{Message: "The scheduler isn't running"})
+		return
+	}
+
+	s.tasksMutex.Lock()
+	initialTasks := s.initialTasks
+	s.tasksMutex.Unlock()
+	for _, task := range initialTasks {
+		select {
+		case <-task.armed:
+		default:
+			writeJSONResponse(writer, http.StatusServiceUnavailable, apiMessageResponse{Message: "Not every task has been scheduled yet"})
+			return
+		}
+	}
+	writeJSONResponse(writer, http.StatusOK, apiMessageResponse{Message: "ok"})
+}
+
+// Whether the scheduler has been started and hasn't been stopped
+func (s *Scheduler) isRunning() bool {
+	s.tasksMutex.Lock()
+	defer s.tasksMutex.Unlock()
+	return s.started && !s.isStopped()
+}
@@ -0,0 +1,101 @@
+package scheduler
+
+import (
+	"errors"
+	"net/http"
+	"os/exec"
+	"time"
+)
+
+// The most of each of a run's stdout and stderr kept in its history. The end is kept as that's usually where the
+// error is
+const maxHistoryOutput = 4096
+
+// A finished run kept in a task's history for the HTTP API
+type runRecord struct {
+	StartedAt  string `json:"started_at"`
+	DurationMs int64  `json:"duration_ms"`
+	Status     string `json:"status"`
+	// Null when the run didn't exit with a code, e.g. it never started or used the runner
+	ExitCode *int   `json:"exit_code"`
+	Error    string `json:"error,omitempty"`
+	Stdout   string `json:"stdout"`
+	Stderr   string `json:"stderr"`
+}
+
+// A ring buffer of a task's most recent runs, so keeping them takes the same memory however long the scheduler runs.
+// Guarded by the task's stateMutex
+type runHistory struct {
+	records []runRecord
+	// Where the next record goes, which is the oldest record once the buffer is full
+	next int
+}
+
+// Adds a run to the history, replacing the oldest run once size runs are kept
+func (h *runHistory) add(record runRecord, size int) {
+	if size <= 0 {
+		return
+	}
+	if len(h.records) < size {
+		h.records = append(h.records, record)
+		return
+	}
+	h.records[h.next] = record
+	h.next = (h.next + 1) % len(h.records)
+}
+
+// Returns a copy of the runs from oldest to newest
+func (h *runHistory) list() []runRecord {
+	records := make([]runRecord, 0, len(h.records))
+	records = append(records, h.records[h.next:]...)
+	return append(records, h.records[:h.next]...)
+}
+
+// Builds the history record for a finished run. Runs with the runner don't start a process, so they don't have an exit
+// code or any output
+func newRunRecord(startedAt time.Time, elapsed time.Duration, ranProcess bool, runErr error, stdout string, stderr string) runRecord {
+	record := runRecord{
+		StartedAt:  startedAt.Format(time.RFC3339),
+		DurationMs: elapsed.Milliseconds(),
+		Status:     StatusSuccess,
+		Stdout:     lastCharacters(stdout, maxHistoryOutput),
+		Stderr:     lastCharacters(stderr, maxHistoryOutput),
+	}
+	var exitErr *exec.ExitError
+	switch {
+	case runErr == nil && ranProcess:
+		exitCode := 0
+		record.ExitCode = &exitCode
+	case runErr == nil:
+	case errors.As(runErr, &exitErr):
+		exitCode := exitErr.ExitCode()
+		record.ExitCode = &exitCode
+		fallthrough
+	default:
+		record.Status = StatusFailure
+		record.Error = runErr.Error()
+	}
+	return record
+}
+
+func (t *scheduledTask) recordHistory(record runRecord, size int) {
+	t.stateMutex.Lock()
+	defer t.stateMutex.Unlock()
+	t.history.add(record, size)
+}
+
+func (t *scheduledTask) recentRuns() []runRecord {
+	t.stateMutex.Lock()
+	defer t.stateMutex.Unlock()
+	return t.history.list()
+}
+
+// Lists a task's most recent runs with their output, oldest first
+func (s *Scheduler) handleTaskLogs(writer http.ResponseWriter, request *http.Request) {
+	task := s.findTask(request.PathValue("name"))
+	if task == nil {
+		writeTaskNotFound(writer, request)
+		return
+	}
+	writeJSONResponse(writer, http.StatusOK, task.recentRuns())
+}
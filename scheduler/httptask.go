@@ -0,0 +1,119 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// The methods an HTTP task can use
+var httpTaskMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+
+// Splits an HTTP task's command into its method and URL. The method can be left out to send a GET
+func parseHTTPTaskCommand(command string) (string, string, error) {
+	fields := strings.Fields(command)
+	method := http.MethodGet
+	switch len(fields) {
+	case 1:
+	case 2:
+		method = strings.ToUpper(fields[0])
+	default:
+		return "", "", fmt.Errorf("expected a method and URL like \"POST https://example.com/refresh\"")
+	}
+	rawURL := fields[len(fields)-1]
+
+	knownMethod := false
+	for _, httpTaskMethod := range httpTaskMethods {
+		knownMethod = knownMethod || method == httpTaskMethod
+	}
+	if !knownMethod {
+		return "", "", fmt.Errorf("unknown method %s, expected one of %s", method, strings.Join(httpTaskMethods, ", "))
+	}
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil || (parsedURL.Scheme != "http" && parsedURL.Scheme != "https") || parsedURL.Host == "" {
+		return "", "", fmt.Errorf("\"%s\" isn't an http or https URL", rawURL)
+	}
+	return method, rawURL, nil
+}
+
+// Makes an HTTP task's request directly rather than running a program. Responses with a status outside 2xx fail the
+// run, and the response body is logged as the run's output
+func (s *Scheduler) runHTTPTask(ctx context.Context, task *scheduledTask) error {
+	taskName := task.displayName()
+
+	request, err := http.NewRequestWithContext(ctx, task.httpMethod, task.httpURL, nil)
+	if err != nil {
+		return err
+	}
+	if task.HTTPBasicAuth != "" {
+		username, password, _ := strings.Cut(task.HTTPBasicAuth, ":")
+		request.SetBasicAuth(username, password)
+	}
+
+	maxOutputBytes := s.options.MaxOutputBytes
+	if maxOutputBytes == 0 {
+		maxOutputBytes = defaultMaxOutputBytes
+	}
+	body := newBoundedBuffer(maxOutputBytes)
+
+	if task.Verbosity == VerbosityVerbose {
+		logTaskMessage(levelInfo, taskName, fmt.Sprintf("task=%s - Sending %s %s", taskName, task.httpMethod, task.httpURL))
+	}
+	s.metrics.runStarted(task.id, taskName, task.Labels)
+	startTime := time.Now()
+	response, err := http.DefaultClient.Do(request)
+	statusCode := 0
+	if err == nil {
+		statusCode = response.StatusCode
+		_, err = io.Copy(body, response.Body)
+		response.Body.Close()
+		if statusCode < 200 || statusCode > 299 {
+			err = fmt.Errorf("responded with %s", response.Status)
+		}
+	}
+	if err != nil {
+		// The request was sent, so a failure to get a good response is worth retrying
+		err = &runFailedError{err: err}
+	}
+	elapsed := time.Since(startTime)
+	s.metrics.runFinished(task.id, elapsed, err == nil)
+	task.recordHistory(newRunRecord(startTime, elapsed, false, err, body.String(), ""), s.options.HistorySize)
+	durationMs := elapsed.Milliseconds()
+	duration := formatRunDuration(elapsed)
+
+	entry := logEntry{Task: taskName, DurationMs: &durationMs, Stdout: body.String()}
+	if err != nil {
+		entry.Level = levelError
+		if s.runContext.Err() != nil {
+			entry.Message = fmt.Sprintf("%s was interrupted as the scheduler stopped", taskName)
+			writeTaskLog(task, entry, fmt.Sprintf("ERROR!: %s duration=%s. %v", entry.Message, duration, err))
+			return err
+		}
+		if ctx.Err() == context.DeadlineExceeded {
+			entry.Message = fmt.Sprintf("%s took longer than its timeout of %v and was cancelled", taskName, task.Timeout)
+			writeTaskLog(task, entry, fmt.Sprintf("ERROR!: %s duration=%s. %v", entry.Message, duration, err))
+			return err
+		}
+		if statusCode == 0 {
+			// The request never got a response (connection refused, DNS failure etc.)
+			entry.Message = fmt.Sprintf("Task's request failed: %v", err)
+			writeTaskLog(task, entry, fmt.Sprintf("ERROR!: task=%s request_failed duration=%s - %v", taskName, duration, err))
+			return err
+		}
+		entry.Message = fmt.Sprintf("Task failed: %v", err)
+		writeTaskLog(task, entry, fmt.Sprintf("ERROR!: task=%s status_code=%d duration=%s - %v. body: %s", taskName, statusCode, duration, err, body.String()))
+		return err
+	}
+
+	if task.Verbosity == VerbosityQuiet {
+		return nil
+	}
+	entry.Level = levelInfo
+	entry.Message = "Task succeeded"
+	writeTaskLog(task, entry, fmt.Sprintf("%s status_code=%d duration=%s - %s", taskName, statusCode, duration, body.String()))
+	return nil
+}
@@ -0,0 +1,55 @@
+package scheduler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Values for the ioprio_set system call, from linux/ioprio.h
+const (
+	ioprioWhoProcessGroup = 2
+	ioprioClassShift      = 13
+)
+
+// The IO scheduling classes by the names ionice(1) uses for them
+var ioPriorityClasses = map[string]int{
+	"realtime":    1,
+	"best-effort": 2,
+	"idle":        3,
+}
+
+// Parses an IO priority like "best-effort:7" into the value ioprio_set takes. The idle class has no levels, the others
+// default to level 4 like ionice(1)
+func parseIOPriority(ioPriorityText string) (int, error) {
+	className, levelText, hasLevel := strings.Cut(strings.ToLower(ioPriorityText), ":")
+	class, isClass := ioPriorityClasses[className]
+	if !isClass {
+		return 0, fmt.Errorf("the class needs to be idle, best-effort or realtime")
+	}
+
+	level := 4
+	switch {
+	case class == ioPriorityClasses["idle"]:
+		if hasLevel {
+			return 0, fmt.Errorf("the idle class doesn't have levels")
+		}
+		level = 0
+	case hasLevel:
+		parsedLevel, err := strconv.Atoi(levelText)
+		if err != nil || parsedLevel < 0 || parsedLevel > 7 {
+			return 0, fmt.Errorf("the level needs to be a number from 0 to 7")
+		}
+		level = parsedLevel
+	}
+	return class<<ioprioClassShift | level, nil
+}
+
+// Sets the IO priority of every process in a run's process group, which the run's pid leads
+func setIOPriority(pid int, ioPriority int) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOPRIO_SET, ioprioWhoProcessGroup, uintptr(pid), uintptr(ioPriority)); errno != 0 {
+		return errno
+	}
+	return nil
+}
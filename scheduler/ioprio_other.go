@@ -0,0 +1,14 @@
+//go:build !linux
+
+package scheduler
+
+import "fmt"
+
+// Always errors, as IO priorities are only supported on Linux
+func parseIOPriority(ioPriorityText string) (int, error) {
+	return 0, fmt.Errorf("setting the IO priority of tasks is only supported on Linux")
+}
+
+func setIOPriority(pid int, ioPriority int) error {
+	return nil
+}
@@ -0,0 +1,207 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// A log file that can be rotated. When a maximum size is set the file is rotated once it grows past it,
+// renaming the current file to <path>.1 (shifting older backups up by one) and starting a fresh file.
+// Safe to write to from many task goroutines at once
+type RotatingLogFile struct {
+	mutex sync.Mutex
+	path  string
+	file  *os.File
+	size  int64
+	// The size in bytes the file can grow to before it's rotated. Zero means never rotate
+	maxSize int64
+	// How many rotated files to keep around, the oldest are deleted first
+	maxBackups int
+}
+
+// Opens a log file for appending, creating it if it doesn't exist
+func openLogFile(logPath string) (*os.File, error) {
+	// Open the file as write only, don't care about reading that's for the user
+	return os.OpenFile(logPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+}
+
+// Opens a log file for appending, rotating it once it grows past maxSize bytes and keeping maxBackups of the rotated
+// files. A maxSize of zero means the file is never rotated
+func OpenRotatingLogFile(logPath string, maxSize int64, maxBackups int) (*RotatingLogFile, error) {
+	file, err := openLogFile(logPath)
+	if err != nil {
+		return nil, err
+	}
+	return newRotatingLogFile(logPath, file, maxSize, maxBackups), nil
+}
+
+// Wraps an already open log file, picking up its current size so appending to an existing log rotates at the right time
+func newRotatingLogFile(logPath string, file *os.File, maxSize int64, maxBackups int) *RotatingLogFile {
+	logFile := &RotatingLogFile{
+		path:       logPath,
+		file:       file,
+		maxSize:    maxSize,
+		maxBackups: maxBackups,
+	}
+	if info, err := file.Stat(); err == nil {
+		logFile.size = info.Size()
+	}
+	return logFile
+}
+
+func (l *RotatingLogFile) Write(data []byte) (int, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.maxSize > 0 && l.size > 0 && l.size+int64(len(data)) > l.maxSize {
+		if err := l.rotate(); err != nil {
+			// Keep logging to the current file rather than losing log lines
+			fmt.Fprintln(os.Stderr, fmt.Sprintf("ERROR!: Failed to rotate the log file %s. %v", l.path, err))
+		}
+	}
+
+	written, err := l.file.Write(data)
+	l.size += int64(written)
+	return written, err
+}
+
+// Rotates the file straight away whatever its size, for rotating on a schedule. With no backups to keep the file is
+// started again
+func (l *RotatingLogFile) Rotate() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.rotate()
+}
+
+// Moves the current file to the first backup and opens a fresh one. The lock must already be held
+func (l *RotatingLogFile) rotate() error {
+	if err := l.file.Close(); err != nil {
+		return err
+	}
+
+	if l.maxBackups <= 0 {
+		// No backups to keep, just start the file again
+		if err := os.Remove(l.path); err != nil && !os.IsNotExist(err) {
+			return l.reopenAfterFailure(err)
+		}
+	} else {
+		// Shift every backup up by one, dropping the oldest
+		os.Remove(fmt.Sprintf("%s.%d", l.path, l.maxBackups))
+		for i := l.maxBackups - 1; i >= 1; i-- {
+			os.Rename(fmt.Sprintf("%s.%d", l.path, i), fmt.Sprintf("%s.%d", l.path, i+1))
+		}
+		if err := os.Rename(l.path, l.path+".1"); err != nil {
+			return l.reopenAfterFailure(err)
+		}
+	}
+
+	file, err := openLogFile(l.path)
+	if err != nil {
+		return err
+	}
+	l.file = file
+	l.size = 0
+	return nil
+}
+
+// Reopens the current file so logging can carry on when it couldn't be moved out of the way
+func (l *RotatingLogFile) reopenAfterFailure(rotateErr error) error {
+	file, err := openLogFile(l.path)
+	if err != nil {
+		return err
+	}
+	l.file = file
+	return rotateErr
+}
+
+// Opens the file at the log's path again and carries on writing to it, for when something else (e.g. logrotate) has
+// moved the file away so writes would go to a file that's no longer there. Keeps writing to the current file if the
+// path can't be opened
+func (l *RotatingLogFile) Reopen() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	file, err := openLogFile(l.path)
+	if err != nil {
+		return err
+	}
+	l.file.Close()
+	l.file = file
+	l.size = 0
+	if info, err := file.Stat(); err == nil {
+		l.size = info.Size()
+	}
+	return nil
+}
+
+func (l *RotatingLogFile) Close() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.file.Close()
+}
+
+// Checks no two tasks would write to the same log file in the task log directory
+func checkTaskLogFileNames(taskList []*scheduledTask) error {
+	// Compare without case as the file names would clash on Windows and macOS
+	usedBy := map[string]*scheduledTask{}
+	for _, task := range taskList {
+		fileName := taskLogFileName(task)
+		if other, used := usedBy[strings.ToLower(fileName)]; used {
+			return fmt.Errorf("The tasks %s and %s would both write their logs to %s in the task log directory. Give them different names to keep their logs apart", other.id, task.id, fileName)
+		}
+		usedBy[strings.ToLower(fileName)] = task
+	}
+	return nil
+}
+
+// Opens a task's own log file in the task log directory. The files rotate the same way as the main log
+func (s *Scheduler) openTaskLogFile(task *scheduledTask) error {
+	logPath := filepath.Join(s.options.TaskLogDir, taskLogFileName(task))
+	logFile, err := OpenRotatingLogFile(logPath, s.options.TaskLogMaxSize, s.options.TaskLogMaxBackups)
+	if err != nil {
+		return fmt.Errorf("failed to open the log file for %s: %v", task.id, err)
+	}
+	task.outputLogFile = logFile
+	task.outputLog = log.New(task.outputLogFile, "", log.Flags())
+	return nil
+}
+
+// The name of a task's log file. Anything that isn't safe in a file name is replaced with an underscore
+func taskLogFileName(task *scheduledTask) string {
+	safeName := strings.Map(func(char rune) rune {
+		if (char >= 'a' && char <= 'z') || (char >= 'A' && char <= 'Z') || (char >= '0' && char <= '9') || char == '-' || char == '_' || char == '.' {
+			return char
+		}
+		return '_'
+	}, task.id)
+	return safeName + ".log"
+}
+
+// Reopens every task's own log file the same way as RotatingLogFile.Reopen, for when they've been moved away by
+// something else. Returns the errors of any that couldn't be reopened, which keep writing to their current file
+func (s *Scheduler) ReopenTaskLogFiles() error {
+	var errs []error
+	for _, task := range s.currentTasks() {
+		if task.outputLogFile == nil {
+			continue
+		}
+		if err := task.outputLogFile.Reopen(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to reopen the log file for %s: %v", task.id, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Closes every task's own log file
+func closeTaskLogFiles(taskList []*scheduledTask) {
+	for _, task := range taskList {
+		if task.outputLogFile != nil {
+			task.outputLogFile.Close()
+		}
+	}
+}
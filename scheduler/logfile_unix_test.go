@@ -0,0 +1,30 @@
+//go:build !windows
+
+package scheduler
+
+import (
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestOpenRotatingLogFileMode(t *testing.T) {
+	// Clear the umask so the mode the file is opened with is the mode it ends up with
+	oldUmask := syscall.Umask(0)
+	defer syscall.Umask(oldUmask)
+
+	logPath := filepath.Join(t.TempDir(), "task-scheduler.log")
+	logFile, err := OpenRotatingLogFile(logPath, 0, 0)
+	if err != nil {
+		t.Fatalf("OpenRotatingLogFile(%s) failed: %v", logPath, err)
+	}
+	defer logFile.Close()
+
+	info, err := logFile.file.Stat()
+	if err != nil {
+		t.Fatalf("can't stat %s: %v", logPath, err)
+	}
+	if mode := info.Mode().Perm(); mode != 0o644 {
+		t.Errorf("%s was created with mode %#o, expected 0644", logPath, mode)
+	}
+}
@@ -0,0 +1,161 @@
+package scheduler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// The format log lines are written in. Either "text" (the default) or "json" for log aggregators
+var logFormat = "text"
+
+// Whether text log lines are coloured by level. Only meant for while the logs are written to a terminal
+var colorLogs = false
+
+// The file the main log is written to, rotated by the @rotate-logs built-in task. Nil when it isn't written to a file
+var mainLogFile *RotatingLogFile
+
+// The ANSI escape codes log lines are coloured with
+const (
+	colorRed    = "\033[31m"
+	colorYellow = "\033[33m"
+	colorGreen  = "\033[32m"
+	colorReset  = "\033[0m"
+)
+
+const (
+	levelInfo    = "info"
+	levelWarning = "warning"
+	levelError   = "error"
+)
+
+// A single log line. In the json format this is written as is, the text format only uses the message
+type logEntry struct {
+	Time       string `json:"time"`
+	Level      string `json:"level"`
+	Task       string `json:"task,omitempty"`
+	DurationMs *int64 `json:"duration_ms,omitempty"`
+	ExitCode   *int   `json:"exit_code,omitempty"`
+	Stdout     string `json:"stdout,omitempty"`
+	Stderr     string `json:"stderr,omitempty"`
+	Message    string `json:"message"`
+}
+
+// Switches the log output to the given format, either "text" or "json"
+func SetLogFormat(format string) error {
+	switch format {
+	case "text":
+		log.SetFlags(log.LstdFlags)
+	case "json":
+		// The time is written as a field instead of the usual prefix so every line is valid JSON
+		log.SetFlags(0)
+	default:
+		return fmt.Errorf("unknown log format \"%s\", expected text or json", format)
+	}
+	logFormat = format
+	return nil
+}
+
+// Turns colouring text log lines by level on or off: red for errors, yellow for warnings and green for runs that
+// succeeded. Should only be on while the log is written to a terminal, as the colour codes would end up in files
+func SetLogColor(enabled bool) {
+	colorLogs = enabled
+}
+
+// Sets the file the main log is written to, so the @rotate-logs built-in task rotates it along with the task log files.
+// Doesn't change where the log is written, that's still up to log.SetOutput
+func SetLogFile(logFile *RotatingLogFile) {
+	mainLogFile = logFile
+}
+
+// Writes a log entry in the current format. The text version of the line is given separately so the text format
+// can keep its existing layout
+func writeLog(entry logEntry, text string) {
+	log.Print(colorLogLine(entry, formatLogLine(entry, text)))
+}
+
+// Writes a log entry about a task's run to the main log, and to the task's own log file if there's a task log directory
+func writeTaskLog(task *scheduledTask, entry logEntry, text string) {
+	line := formatLogLine(entry, text)
+	log.Print(colorLogLine(entry, line))
+	// Task log files are never a terminal so they're never coloured
+	if task.outputLog != nil {
+		task.outputLog.Print(line)
+	}
+}
+
+// Colours a formatted log line by its level when colouring is on. JSON lines are left alone so they stay valid
+func colorLogLine(entry logEntry, line string) string {
+	if !colorLogs || logFormat == "json" {
+		return line
+	}
+	color := ""
+	switch {
+	case entry.Level == levelError:
+		color = colorRed
+	case entry.Level == levelWarning:
+		color = colorYellow
+	case entry.Level == levelInfo && entry.DurationMs != nil:
+		// Only a finished run has a duration, so this is a run that succeeded
+		color = colorGreen
+	}
+	if color == "" {
+		return line
+	}
+	// Reset before the newline so a line cut short doesn't colour the next
+	return color + strings.TrimSuffix(line, "\n") + colorReset + "\n"
+}
+
+// Formats a log entry as a single line in the current format, ending in a newline
+func formatLogLine(entry logEntry, text string) string {
+	if logFormat != "json" {
+		return text + "\n"
+	}
+
+	entry.Time = time.Now().Format(time.RFC3339Nano)
+	var line bytes.Buffer
+	encoder := json.NewEncoder(&line)
+	// Commands are full of characters like > and &, keep them readable
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(entry); err != nil {
+		// Shouldn't be possible with only strings and numbers, but don't lose the message if it happens
+		return text + "\n"
+	}
+	// The encoder already ends the line
+	return line.String()
+}
+
+// Logs a general message
+func LogInfo(message string) {
+	writeLog(logEntry{Level: levelInfo, Message: message}, message)
+}
+
+// Logs something that might be a problem but doesn't stop anything from running
+func LogWarning(message string) {
+	writeLog(logEntry{Level: levelWarning, Message: message}, "WARNING!: "+message)
+}
+
+// Logs a failure
+func LogError(message string) {
+	writeLog(logEntry{Level: levelError, Message: message}, "ERROR!: "+message)
+}
+
+// Logs a general message about a specific task, which is kept as its own field in the json format
+func LogTaskInfo(taskName string, message string) {
+	logTaskMessage(levelInfo, taskName, message)
+}
+
+// Logs a message about a specific task so it can be filtered by task in the json format
+func logTaskMessage(level string, taskName string, message string) {
+	text := message
+	switch level {
+	case levelWarning:
+		text = "WARNING!: " + message
+	case levelError:
+		text = "ERROR!: " + message
+	}
+	writeLog(logEntry{Level: level, Task: taskName, Message: message}, text)
+}
@@ -0,0 +1,194 @@
+package scheduler
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metric names served by MetricsHandler. These are relied on by dashboards and alerts so they shouldn't change
+const (
+	// Counter of finished task runs, labelled by task id, name and status ("success" or "failure")
+	metricTaskRuns = "task_scheduler_task_runs_total"
+	// Histogram of how long task runs took in seconds, labelled by task id and name
+	metricTaskDuration = "task_scheduler_task_duration_seconds"
+	// Gauge of how many runs of a task are currently running, labelled by task id and name
+	metricTasksRunning = "task_scheduler_tasks_running"
+)
+
+// The upper bounds of the task duration histogram buckets, in seconds
+var durationBuckets = []float64{0.1, 0.5, 1, 5, 10, 30, 60, 300, 600, 1800, 3600}
+
+// A histogram of task durations in the same shape Prometheus expects
+type durationHistogram struct {
+	// The number of observations that fell in each bucket, not cumulative
+	bucketCounts []uint64
+	count        uint64
+	sum          float64
+}
+
+// Collects metrics for every task, by task id so tasks sharing a name keep their own series. Safe to update from many
+// task goroutines at once
+type taskMetrics struct {
+	mutex     sync.Mutex
+	successes map[string]uint64
+	failures  map[string]uint64
+	durations map[string]*durationHistogram
+	running   map[string]int64
+	// The task's name, given as the name label on each of its metrics
+	names map[string]string
+	// The task's own labels, added to the task and name labels on each of its metrics
+	labels map[string]map[string]string
+}
+
+func newTaskMetrics() *taskMetrics {
+	return &taskMetrics{
+		successes: map[string]uint64{},
+		failures:  map[string]uint64{},
+		durations: map[string]*durationHistogram{},
+		running:   map[string]int64{},
+		names:     map[string]string{},
+		labels:    map[string]map[string]string{},
+	}
+}
+
+// Returns a handler serving the metrics for every task's runs in the Prometheus text format
+func (s *Scheduler) MetricsHandler() http.Handler {
+	return s.metrics
+}
+
+// Records that a run of a task has started, along with the name and labels its metrics are given
+func (m *taskMetrics) runStarted(taskID string, taskName string, labels map[string]string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.running[taskID]++
+	m.names[taskID] = taskName
+	m.labels[taskID] = labels
+}
+
+// Records that a run of a task has finished along with how long it took and whether it succeeded
+func (m *taskMetrics) runFinished(taskID string, duration time.Duration, succeeded bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.running[taskID]--
+	if succeeded {
+		m.successes[taskID]++
+	} else {
+		m.failures[taskID]++
+	}
+
+	histogram, exists := m.durations[taskID]
+	if !exists {
+		histogram = &durationHistogram{bucketCounts: make([]uint64, len(durationBuckets))}
+		m.durations[taskID] = histogram
+	}
+	seconds := duration.Seconds()
+	for i, upperBound := range durationBuckets {
+		if seconds <= upperBound {
+			histogram.bucketCounts[i]++
+			break
+		}
+	}
+	histogram.count++
+	histogram.sum += seconds
+}
+
+// Writes every metric in the Prometheus text format
+func (m *taskMetrics) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	writer.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	var out strings.Builder
+
+	fmt.Fprintf(&out, "# HELP %s The number of finished task runs by task and status.\n", metricTaskRuns)
+	fmt.Fprintf(&out, "# TYPE %s counter\n", metricTaskRuns)
+	// Every task that has run has a running gauge, so its ids cover the other metrics too
+	taskIDs := m.taskIDs()
+	for _, taskID := range taskIDs {
+		labels := m.formatLabels(taskID)
+		fmt.Fprintf(&out, "%s{%s,status=\"success\"} %d\n", metricTaskRuns, labels, m.successes[taskID])
+		fmt.Fprintf(&out, "%s{%s,status=\"failure\"} %d\n", metricTaskRuns, labels, m.failures[taskID])
+	}
+
+	fmt.Fprintf(&out, "# HELP %s How long task runs took in seconds.\n", metricTaskDuration)
+	fmt.Fprintf(&out, "# TYPE %s histogram\n", metricTaskDuration)
+	for _, taskID := range taskIDs {
+		histogram, exists := m.durations[taskID]
+		if !exists {
+			// Still running its first run
+			continue
+		}
+		labels := m.formatLabels(taskID)
+		var cumulative uint64
+		for i, upperBound := range durationBuckets {
+			cumulative += histogram.bucketCounts[i]
+			fmt.Fprintf(&out, "%s_bucket{%s,le=\"%s\"} %d\n", metricTaskDuration, labels, strconv.FormatFloat(upperBound, 'g', -1, 64), cumulative)
+		}
+		fmt.Fprintf(&out, "%s_bucket{%s,le=\"+Inf\"} %d\n", metricTaskDuration, labels, histogram.count)
+		fmt.Fprintf(&out, "%s_sum{%s} %s\n", metricTaskDuration, labels, strconv.FormatFloat(histogram.sum, 'g', -1, 64))
+		fmt.Fprintf(&out, "%s_count{%s} %d\n", metricTaskDuration, labels, histogram.count)
+	}
+
+	fmt.Fprintf(&out, "# HELP %s The number of task runs currently running.\n", metricTasksRunning)
+	fmt.Fprintf(&out, "# TYPE %s gauge\n", metricTasksRunning)
+	for _, taskID := range taskIDs {
+		fmt.Fprintf(&out, "%s{%s} %d\n", metricTasksRunning, m.formatLabels(taskID), m.running[taskID])
+	}
+
+	writer.Write([]byte(out.String()))
+}
+
+// Returns every task id that has a metric in alphabetical order, so output is stable. The lock must already be held
+func (m *taskMetrics) taskIDs() []string {
+	var ids []string
+	for id := range m.running {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Formats the task and name labels and the task's own labels for its metrics, e.g. task="backup-2",name="backup",
+// team="infra". The task's labels are sorted so output is stable. The lock must already be held
+func (m *taskMetrics) formatLabels(taskID string) string {
+	taskLabels := m.labels[taskID]
+	keys := make([]string, 0, len(taskLabels))
+	for key := range taskLabels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	formatted := []string{fmt.Sprintf("task=\"%s\"", escapeLabel(taskID)), fmt.Sprintf("name=\"%s\"", escapeLabel(m.names[taskID]))}
+	for _, key := range keys {
+		formatted = append(formatted, fmt.Sprintf("%s=\"%s\"", key, escapeLabel(taskLabels[key])))
+	}
+	return strings.Join(formatted, ",")
+}
+
+// The labels the metrics already give, which a task's own labels can't replace
+var reservedLabelNames = []string{"task", "name", "status", "le"}
+
+// Checks a task's label name can be used as a Prometheus label, letters, numbers and underscores not starting with a
+// number or two underscores
+func ValidateLabelName(name string) error {
+	for _, reserved := range reservedLabelNames {
+		if name == reserved {
+			return fmt.Errorf("the label %s is already used by the metrics, it can't be set on a task", name)
+		}
+	}
+	if !isEnvFileKey(name) || strings.HasPrefix(name, "__") {
+		return fmt.Errorf("\"%s\" isn't a valid label name, only letters, numbers and underscores can be used and it can't start with a number or __", name)
+	}
+	return nil
+}
+
+// Escapes a label value as the Prometheus text format requires
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
@@ -0,0 +1,33 @@
+package scheduler
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetricsKeepTasksSharingANameApart(t *testing.T) {
+	metrics := newTaskMetrics()
+	metrics.runStarted("backup", "backup", nil)
+	metrics.runFinished("backup", time.Second, true)
+	metrics.runStarted("backup-2", "backup", map[string]string{"team": "infra"})
+	metrics.runFinished("backup-2", time.Second, false)
+
+	recorder := httptest.NewRecorder()
+	metrics.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	output := recorder.Body.String()
+
+	for _, expected := range []string{
+		`task_scheduler_task_runs_total{task="backup",name="backup",status="success"} 1`,
+		`task_scheduler_task_runs_total{task="backup",name="backup",status="failure"} 0`,
+		`task_scheduler_task_runs_total{task="backup-2",name="backup",team="infra",status="success"} 0`,
+		`task_scheduler_task_runs_total{task="backup-2",name="backup",team="infra",status="failure"} 1`,
+		`task_scheduler_task_duration_seconds_count{task="backup-2",name="backup",team="infra"} 1`,
+		`task_scheduler_tasks_running{task="backup",name="backup"} 0`,
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("expected the metrics to contain %s, got:\n%s", expected, output)
+		}
+	}
+}
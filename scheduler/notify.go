@@ -0,0 +1,158 @@
+package scheduler
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// The most of a failed run's stderr to include in a notification. Slack rejects text blocks over 3000 characters
+const maxNotificationStderr = 2000
+
+// Delivers notifications, with a timeout so a webhook that never answers can't pile up goroutines
+var notificationClient = &http.Client{Timeout: 10 * time.Second}
+
+// A failed run along with the stderr that explains it, so notifications can include it
+type runOutputError struct {
+	err    error
+	stderr string
+}
+
+func (e *runOutputError) Error() string {
+	return e.err.Error()
+}
+
+func (e *runOutputError) Unwrap() error {
+	return e.err
+}
+
+// Sends a notification for a task whose run failed, once it has used up its retries. Delivery happens in the
+// background so a slow webhook doesn't hold up the task's next run
+func (s *Scheduler) notifyFailure(task *scheduledTask, runErr error) {
+	if s.options.SlackWebhookURL == "" {
+		return
+	}
+
+	message := slackFailureMessage(task.displayName(), runErr)
+	s.startRun(func() { postWebhook(task.displayName(), "Slack", s.options.SlackWebhookURL, message) })
+}
+
+// The message posted to the max failures webhook when a task stops being scheduled
+type maxFailuresMessage struct {
+	Task                string    `json:"task"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	Error               string    `json:"error"`
+	StoppedAt           time.Time `json:"stopped_at"`
+}
+
+// Sends a notification for a task that stopped being scheduled after failing too many times in a row, in the
+// background like notifyFailure
+func (s *Scheduler) notifyStopped(task *scheduledTask, failures int, runErr error) {
+	if s.options.MaxFailuresWebhookURL == "" {
+		return
+	}
+
+	message := maxFailuresMessage{Task: task.displayName(), ConsecutiveFailures: failures, StoppedAt: time.Now()}
+	if runErr != nil {
+		message.Error = runErr.Error()
+	}
+	s.startRun(func() { postWebhook(task.displayName(), "max failures", s.options.MaxFailuresWebhookURL, message) })
+}
+
+// Posts a JSON payload to a webhook. Failures are logged and otherwise ignored, a broken webhook shouldn't stop any
+// tasks from running
+func postWebhook(taskName string, webhookName string, url string, payload interface{}) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		logTaskMessage(levelError, taskName, fmt.Sprintf("Failed to build the %s notification for %s. %v", webhookName, taskName, err))
+		return
+	}
+
+	response, err := notificationClient.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		logTaskMessage(levelError, taskName, fmt.Sprintf("Failed to send the %s notification for %s. %v", webhookName, taskName, err))
+		return
+	}
+	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		logTaskMessage(levelError, taskName, fmt.Sprintf("Failed to send the %s notification for %s. The webhook responded with %s", webhookName, taskName, response.Status))
+	}
+}
+
+// The parts of a Slack message used by slackFailureMessage. Text is shown in notifications where blocks can't be
+type slackMessage struct {
+	Text   string       `json:"text"`
+	Blocks []slackBlock `json:"blocks"`
+}
+
+type slackBlock struct {
+	Type   string      `json:"type"`
+	Text   *slackText  `json:"text,omitempty"`
+	Fields []slackText `json:"fields,omitempty"`
+}
+
+type slackText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// Builds a Slack message describing a failed run, with the task's name, its exit code and the end of its stderr
+func slackFailureMessage(taskName string, runErr error) slackMessage {
+	exitCode := "none, it didn't exit"
+	var exitErr *exec.ExitError
+	if errors.As(runErr, &exitErr) {
+		exitCode = fmt.Sprint(exitErr.ExitCode())
+	}
+
+	message := slackMessage{
+		Text: escapeSlackText(fmt.Sprintf("%s failed: %v", taskName, runErr)),
+		Blocks: []slackBlock{
+			{Type: "header", Text: &slackText{Type: "plain_text", Text: truncateText(fmt.Sprintf("%s failed", taskName), 150)}},
+			{Type: "section", Fields: []slackText{
+				{Type: "mrkdwn", Text: "*Task*\n" + escapeSlackText(taskName)},
+				{Type: "mrkdwn", Text: "*Exit code*\n" + exitCode},
+			}},
+			{Type: "section", Text: &slackText{Type: "mrkdwn", Text: "*Error*\n" + escapeSlackText(runErr.Error())}},
+		},
+	}
+
+	var outputErr *runOutputError
+	if errors.As(runErr, &outputErr) && strings.TrimSpace(outputErr.stderr) != "" {
+		stderr := lastCharacters(strings.TrimSpace(outputErr.stderr), maxNotificationStderr)
+		// Backticks in the output would end the code block early
+		stderr = strings.ReplaceAll(escapeSlackText(stderr), "```", "'''")
+		message.Blocks = append(message.Blocks, slackBlock{
+			Type: "section",
+			Text: &slackText{Type: "mrkdwn", Text: "*Stderr*\n```" + stderr + "```"},
+		})
+	}
+	return message
+}
+
+// Escapes the characters Slack uses for links and mentions
+func escapeSlackText(text string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(text)
+}
+
+// Shortens text to at most the given number of characters, marking that some was cut off
+func truncateText(text string, maxLength int) string {
+	characters := []rune(text)
+	if len(characters) <= maxLength {
+		return text
+	}
+	return string(characters[:maxLength-1]) + "…"
+}
+
+// Keeps the end of the text, where the error that stopped a task usually is, marking that the start was cut off
+func lastCharacters(text string, maxLength int) string {
+	characters := []rune(text)
+	if len(characters) <= maxLength {
+		return text
+	}
+	return "…" + string(characters[len(characters)-maxLength+1:])
+}
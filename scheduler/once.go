@@ -0,0 +1,83 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// How a task's run went when the scheduler was run with RunOnce
+type RunResult struct {
+	ID string
+	// One of the run statuses, or StatusSkipped when the task didn't run
+	Status   string
+	Duration time.Duration
+}
+
+// Runs every task once, one after the other, then returns how each run went. Schedules and jitter are ignored, but
+// everything else about the task (timeouts, retries, prerequisites etc.) applies. Tasks run after their prerequisites.
+// Stopping the scheduler, or ctx being done, skips the tasks that haven't run yet. Can't be used with Start
+func (s *Scheduler) RunOnce(ctx context.Context) ([]RunResult, error) {
+	s.tasksMutex.Lock()
+	if err := s.prepareToRun(ctx); err != nil {
+		s.tasksMutex.Unlock()
+		return nil, err
+	}
+	tasks := tasksInDependencyOrder(s.tasks)
+	s.tasksMutex.Unlock()
+
+	var results []RunResult
+	var succeeded, failed, skipped []string
+	for _, task := range tasks {
+		result := RunResult{ID: task.id, Status: StatusSkipped}
+		if !task.Disabled && !s.isStopped() {
+			lastRunBefore := task.status().LastRun
+			startedAt := time.Now()
+			s.runTask(task)
+			result.Duration = time.Since(startedAt)
+			if status := task.status(); !status.LastRun.Equal(lastRunBefore) {
+				result.Status = status.LastStatus
+			}
+		}
+
+		switch result.Status {
+		case StatusSuccess:
+			succeeded = append(succeeded, task.id)
+		case StatusSkipped:
+			skipped = append(skipped, task.id)
+		default:
+			failed = append(failed, task.id)
+		}
+		results = append(results, result)
+	}
+
+	LogInfo(fmt.Sprintf("Ran every task once. Succeeded: %s. Failed: %s. Skipped: %s", describeTaskIDs(succeeded), describeTaskIDs(failed), describeTaskIDs(skipped)))
+	return results, nil
+}
+
+// Orders tasks so every task comes after its prerequisite, otherwise keeping the order they were given in.
+// The prerequisites must already have been checked for loops
+func tasksInDependencyOrder(tasks []*scheduledTask) []*scheduledTask {
+	tasksByID := map[string]*scheduledTask{}
+	for _, task := range tasks {
+		tasksByID[task.id] = task
+	}
+
+	ordered := make([]*scheduledTask, 0, len(tasks))
+	added := map[string]bool{}
+	var add func(task *scheduledTask)
+	add = func(task *scheduledTask) {
+		if added[task.id] {
+			return
+		}
+		added[task.id] = true
+		if prerequisite, exists := tasksByID[task.After]; exists {
+			add(prerequisite)
+		}
+		ordered = append(ordered, task)
+	}
+	for _, task := range tasks {
+		add(task)
+	}
+	return ordered
+}
@@ -0,0 +1,52 @@
+package scheduler
+
+import (
+	"bytes"
+)
+
+// How much of each of a task's stdout and stderr is kept when MaxOutputBytes isn't set
+const defaultMaxOutputBytes = 1024 * 1024
+
+// Added to the end of output that was cut off at the limit
+const truncatedMarker = "...[truncated]"
+
+// A buffer for a task's output that stops keeping anything once it reaches its limit, so a task that prints
+// gigabytes can't use up the scheduler's memory
+type boundedBuffer struct {
+	buffer bytes.Buffer
+	// The most bytes to keep. Negative means there's no limit
+	limit     int64
+	truncated bool
+}
+
+func newBoundedBuffer(limit int64) *boundedBuffer {
+	return &boundedBuffer{limit: limit}
+}
+
+// Keeps as much of the output as fits. Always reports everything as written so the task isn't stopped by a write error
+func (b *boundedBuffer) Write(output []byte) (int, error) {
+	if b.limit < 0 {
+		return b.buffer.Write(output)
+	}
+
+	written := len(output)
+	remaining := b.limit - int64(b.buffer.Len())
+	if int64(len(output)) > remaining {
+		b.truncated = true
+		output = output[:max(remaining, 0)]
+	}
+	b.buffer.Write(output)
+	return written, nil
+}
+
+// The output that was kept, marked as truncated if some was cut off
+func (b *boundedBuffer) String() string {
+	if b.truncated {
+		return b.buffer.String() + truncatedMarker
+	}
+	return b.buffer.String()
+}
+
+func (b *boundedBuffer) Len() int {
+	return b.buffer.Len()
+}
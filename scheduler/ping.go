@@ -0,0 +1,72 @@
+package scheduler
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Checks a ping URL is an http or https URL a GET can be sent to
+func validatePingURL(pingURL string) error {
+	parsedURL, err := url.Parse(pingURL)
+	if err != nil || (parsedURL.Scheme != "http" && parsedURL.Scheme != "https") || parsedURL.Host == "" {
+		return fmt.Errorf("\"%s\" isn't an http or https URL", pingURL)
+	}
+	return nil
+}
+
+// Pings the task's ping URL with /start added as a run begins, when it pings starts and failures. Waits for the ping,
+// so it always arrives before the ping for how the run went
+func (s *Scheduler) pingRunStarted(task *scheduledTask) {
+	if task.PingURL == "" || !task.PingStartAndFail {
+		return
+	}
+	sendPing(task, pingVariantURL(task.PingURL, "start"))
+}
+
+// Pings the task's ping URL once a run has finished, after any retries. Successful runs ping the URL itself and
+// failed runs ping it with /fail added, when it pings failures. Sent in the background so a slow monitoring service
+// doesn't hold up the task's next run
+func (s *Scheduler) pingRunFinished(task *scheduledTask, succeeded bool) {
+	if task.PingURL == "" {
+		return
+	}
+	pingURL := task.PingURL
+	if !succeeded {
+		if !task.PingStartAndFail {
+			// Monitoring notices the missing success ping
+			return
+		}
+		pingURL = pingVariantURL(task.PingURL, "fail")
+	}
+	s.startRun(func() { sendPing(task, pingURL) })
+}
+
+// Adds a variant like start or fail to the end of a ping URL's path, the way Healthchecks.io style services expect
+func pingVariantURL(pingURL string, variant string) string {
+	parsedURL, err := url.Parse(pingURL)
+	if err != nil {
+		// Already checked when the task was added
+		return pingURL
+	}
+	parsedURL.Path = strings.TrimSuffix(parsedURL.Path, "/") + "/" + variant
+	return parsedURL.String()
+}
+
+// Sends a GET to a ping URL. Delivery is best effort, a ping that fails is logged as a warning and not retried
+func sendPing(task *scheduledTask, pingURL string) {
+	taskName := task.displayName()
+	response, err := notificationClient.Get(pingURL)
+	if err != nil {
+		logTaskMessage(levelWarning, taskName, fmt.Sprintf("Failed to ping %s for %s. %v", pingURL, taskName, err))
+		return
+	}
+	response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		logTaskMessage(levelWarning, taskName, fmt.Sprintf("Pinging %s for %s responded with %s", pingURL, taskName, response.Status))
+		return
+	}
+	if task.Verbosity == VerbosityVerbose {
+		logTaskMessage(levelInfo, taskName, fmt.Sprintf("task=%s - Pinged %s", taskName, pingURL))
+	}
+}
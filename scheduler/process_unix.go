@@ -0,0 +1,84 @@
+//go:build !windows
+
+package scheduler
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"strconv"
+	"syscall"
+)
+
+// Starts the command in its own process group and kills the whole group when the command's context is cancelled,
+// otherwise any child processes the task started would be left running
+func killProcessGroupOnCancel(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+
+	cmd.Cancel = func() error {
+		// A negative pid sends the signal to every process in the group
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
+
+// Nice values can be set on every Unix
+const niceSupported = true
+
+// Sets the nice value of every process in a run's process group, which the run's pid leads
+func setNice(pid int, nice int) error {
+	return syscall.Setpriority(syscall.PRIO_PGRP, pid, nice)
+}
+
+// The user and group a task's processes are started as
+type processCredential = syscall.Credential
+
+// Looks up the user and group to run a task as, either of which can be a name or an id. Without a group the user's
+// own groups are used, and without a user the task keeps the scheduler's user
+func resolveRunAs(userName string, groupName string) (*processCredential, error) {
+	credential := &processCredential{Uid: uint32(os.Getuid()), Gid: uint32(os.Getgid())}
+
+	if userName != "" {
+		runAsUser, err := user.Lookup(userName)
+		if err != nil {
+			if runAsUser, err = user.LookupId(userName); err != nil {
+				return nil, fmt.Errorf("the user %s doesn't exist", userName)
+			}
+		}
+		uid, _ := strconv.ParseUint(runAsUser.Uid, 10, 32)
+		gid, _ := strconv.ParseUint(runAsUser.Gid, 10, 32)
+		credential.Uid = uint32(uid)
+		credential.Gid = uint32(gid)
+		// Keep the user's other groups, otherwise the scheduler's own groups would be dropped and leave nothing
+		groupIDs, _ := runAsUser.GroupIds()
+		for _, groupID := range groupIDs {
+			if id, err := strconv.ParseUint(groupID, 10, 32); err == nil {
+				credential.Groups = append(credential.Groups, uint32(id))
+			}
+		}
+	}
+
+	if groupName != "" {
+		runAsGroup, err := user.LookupGroup(groupName)
+		if err != nil {
+			if runAsGroup, err = user.LookupGroupId(groupName); err != nil {
+				return nil, fmt.Errorf("the group %s doesn't exist", groupName)
+			}
+		}
+		gid, _ := strconv.ParseUint(runAsGroup.Gid, 10, 32)
+		credential.Gid = uint32(gid)
+		credential.Groups = []uint32{credential.Gid}
+	}
+	return credential, nil
+}
+
+// Starts the command's process as the given user and group
+func setRunAs(cmd *exec.Cmd, credential *processCredential) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Credential = credential
+}
@@ -0,0 +1,34 @@
+//go:build windows
+
+package scheduler
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+)
+
+// Kills the command along with its child processes when the command's context is cancelled.
+// Windows has no process groups to signal so taskkill is used to walk the process tree instead
+func killProcessGroupOnCancel(cmd *exec.Cmd) {
+	cmd.Cancel = func() error {
+		return exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(cmd.Process.Pid)).Run()
+	}
+}
+
+// Windows has priority classes rather than nice values, so tasks can't be given one
+const niceSupported = false
+
+func setNice(pid int, nice int) error {
+	return nil
+}
+
+// Windows can't start processes as another user without their password, so there's nothing to hold
+type processCredential struct{}
+
+// Always errors, as running tasks as another user is only supported on Unix
+func resolveRunAs(userName string, groupName string) (*processCredential, error) {
+	return nil, fmt.Errorf("running tasks as another user or group is only supported on Unix")
+}
+
+func setRunAs(cmd *exec.Cmd, credential *processCredential) {}
@@ -0,0 +1,203 @@
+package scheduler
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Replaces the scheduled tasks with a new list, comparing them against the current tasks by id.
+// New tasks are started, removed tasks are stopped and changed tasks are restarted with their new settings.
+// Tasks that haven't changed keep running untouched so their schedules stay where they were.
+// Nothing is changed if any of the new tasks are invalid
+func (s *Scheduler) Reload(taskList []Task) error {
+	var newTasks []*scheduledTask
+	for _, task := range taskList {
+		newTask, err := newScheduledTask(task)
+		if err != nil {
+			return err
+		}
+		if err := assignTaskID(newTask, newTasks); err != nil {
+			return err
+		}
+		newTasks = append(newTasks, newTask)
+	}
+	if s.options.TaskLogDir != "" {
+		if err := checkTaskLogFileNames(newTasks); err != nil {
+			return err
+		}
+	}
+	if err := checkDependencies(newTasks); err != nil {
+		return err
+	}
+
+	s.tasksMutex.Lock()
+	defer s.tasksMutex.Unlock()
+	if s.isStopped() {
+		return fmt.Errorf("the scheduler has been stopped")
+	}
+
+	oldTasks := map[string]*scheduledTask{}
+	for _, task := range s.tasks {
+		oldTasks[task.id] = task
+	}
+
+	var added, changed, removed []string
+	var toStart []*scheduledTask
+	unchanged := 0
+	for i, newTask := range newTasks {
+		oldTask, existed := oldTasks[newTask.id]
+		delete(oldTasks, newTask.id)
+
+		switch {
+		case !existed:
+			if s.started && s.options.TaskLogDir != "" {
+				if err := s.openTaskLogFile(newTask); err != nil {
+					LogError(fmt.Sprintf("%v. Only logging %s to the main log", err, newTask.id))
+				}
+			}
+			added = append(added, newTask.id)
+			toStart = append(toStart, newTask)
+		case oldTask.sameSettings(newTask):
+			// Keep the running task so its schedule isn't reset
+			newTasks[i] = oldTask
+			unchanged++
+		default:
+			newTask.takeOver(oldTask, s.started)
+			close(oldTask.stop)
+			changed = append(changed, newTask.id)
+			toStart = append(toStart, newTask)
+		}
+	}
+
+	// Whatever is left over is no longer in the list. Go through the old list to keep the order they were given in
+	for _, task := range s.tasks {
+		if _, isRemoved := oldTasks[task.id]; isRemoved {
+			close(task.stop)
+			go retireTask(task)
+			removed = append(removed, task.id)
+		}
+	}
+
+	s.tasks = newTasks
+	if s.started {
+		for _, task := range toStart {
+			s.startScheduling(task)
+		}
+	}
+
+	LogInfo(fmt.Sprintf("Reloaded tasks. Added: %s. Changed: %s. Removed: %s. %d unchanged", describeTaskIDs(added), describeTaskIDs(changed), describeTaskIDs(removed), unchanged))
+	return nil
+}
+
+// Checks whether a reloaded task has the same settings as the running task, so it can be left running
+func (t *scheduledTask) sameSettings(other *scheduledTask) bool {
+	if len(t.Env) != len(other.Env) {
+		return false
+	}
+	for i := range t.Env {
+		if t.Env[i] != other.Env[i] {
+			return false
+		}
+	}
+	if len(t.Labels) != len(other.Labels) {
+		return false
+	}
+	for name, value := range t.Labels {
+		if otherValue, exists := other.Labels[name]; !exists || otherValue != value {
+			return false
+		}
+	}
+	if len(t.RetryOnCodes) != len(other.RetryOnCodes) {
+		return false
+	}
+	for i := range t.RetryOnCodes {
+		if t.RetryOnCodes[i] != other.RetryOnCodes[i] {
+			return false
+		}
+	}
+
+	return t.Name == other.Name &&
+		t.Disabled == other.Disabled &&
+		t.Verbosity == other.Verbosity &&
+		t.User == other.User &&
+		t.After == other.After &&
+		t.Guard == other.Guard &&
+		t.PingURL == other.PingURL &&
+		t.PingStartAndFail == other.PingStartAndFail &&
+		t.Priority == other.Priority &&
+		t.Group == other.Group &&
+		t.Nice == other.Nice &&
+		t.IONice == other.IONice &&
+		t.EnvFile == other.EnvFile &&
+		t.Stdin == other.Stdin &&
+		t.OutputFile == other.OutputFile &&
+		t.OutputFileMode == other.OutputFileMode &&
+		t.Command == other.Command &&
+		t.HTTP == other.HTTP &&
+		t.HTTPBasicAuth == other.HTTPBasicAuth &&
+		t.Interval == other.Interval &&
+		t.Cron == other.Cron &&
+		t.At.Equal(other.At) &&
+		t.Timeout == other.Timeout &&
+		t.Retries == other.Retries &&
+		t.RetryDelay == other.RetryDelay &&
+		t.RetryJitter == other.RetryJitter &&
+		t.Overlap == other.Overlap &&
+		t.Jitter == other.Jitter &&
+		t.Offset == other.Offset &&
+		t.MaxRuns == other.MaxRuns &&
+		t.MaxFailures == other.MaxFailures &&
+		t.BackoffAfter == other.BackoffAfter &&
+		t.BackoffMax == other.BackoffMax &&
+		t.WorkingDir == other.WorkingDir
+}
+
+// Carries over what should survive a reload from the task this one replaces
+func (t *scheduledTask) takeOver(old *scheduledTask, started bool) {
+	// Sharing the lock stops the new settings from overlapping with a run of the old ones that's still going
+	t.mutex = old.mutex
+	t.outputLog = old.outputLog
+	t.outputLogFile = old.outputLogFile
+	if started {
+		// The scheduler has already started, so only new tasks run at start
+		t.RunAtStart = false
+	}
+	// Runs before the reload still count towards the max runs and the shutdown summary
+	t.runCount.Store(old.runCount.Load())
+	t.successCount.Store(old.successCount.Load())
+	t.failureCount.Store(old.failureCount.Load())
+	if t.MaxRuns > 0 && t.runCount.Load() >= int64(t.MaxRuns) {
+		t.stopScheduling()
+	}
+
+	old.stateMutex.Lock()
+	defer old.stateMutex.Unlock()
+	t.lastRun = old.lastRun
+	t.lastStatus = old.lastStatus
+	t.paused = old.paused
+	t.consecutiveFailures = old.consecutiveFailures
+	if t.MaxFailures > 0 && t.consecutiveFailures >= t.MaxFailures {
+		// The reload is the task's fresh start after being stopped for failing, counting on from the old failures
+		// would go past the new max without ever reaching it
+		t.consecutiveFailures = 0
+	}
+	t.averageRunTime = old.averageRunTime
+	t.history = old.history
+}
+
+// Cleans up after a task removed by a reload once any run that's still going has finished
+func retireTask(task *scheduledTask) {
+	task.mutex.Lock()
+	defer task.mutex.Unlock()
+	if task.outputLogFile != nil {
+		task.outputLogFile.Close()
+	}
+}
+
+// Lists task ids for the reload summary
+func describeTaskIDs(ids []string) string {
+	if len(ids) == 0 {
+		return "none"
+	}
+	return strings.Join(ids, ", ")
+}
@@ -0,0 +1,39 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReloadedTaskCanStopForFailuresAgain(t *testing.T) {
+	tests := []struct {
+		name             string
+		oldMaxFailures   int
+		newMaxFailures   int
+		oldFailures      int
+		expectedFailures int
+	}{
+		{"stopped and limit lowered", 5, 3, 5, 0},
+		{"stopped and limit kept", 3, 3, 3, 0},
+		{"under the new limit", 5, 10, 4, 4},
+		{"no limit", 3, 0, 3, 3},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			oldTask, err := newScheduledTask(Task{Command: "true", Interval: time.Minute, MaxFailures: test.oldMaxFailures})
+			if err != nil {
+				t.Fatal(err)
+			}
+			oldTask.consecutiveFailures = test.oldFailures
+			newTask, err := newScheduledTask(Task{Command: "true", Interval: time.Hour, MaxFailures: test.newMaxFailures})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			newTask.takeOver(oldTask, true)
+			if newTask.failuresInARow() != test.expectedFailures {
+				t.Errorf("expected %d failures in a row after the reload, got %d", test.expectedFailures, newTask.failuresInARow())
+			}
+		})
+	}
+}
@@ -0,0 +1,831 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Run a task on a timer user a channel. Restarted is set when the scheduling is being restarted after a panic, so the
+// runs that only happen when the task is first scheduled are left out
+func (s *Scheduler) scheduleTask(task *scheduledTask, restarted bool) {
+	// Tasks that stop without waiting for a run (e.g. a run once time that has passed) still count as scheduled
+	defer task.markArmed()
+
+	if task.Disabled {
+		return
+	}
+	if !task.At.IsZero() {
+		s.scheduleOneOffTask(task)
+		return
+	}
+	if task.Offset > 0 && !restarted {
+		// Waiting out the offset is waiting for the first run
+		task.markArmed()
+		if !sleepUnlessStopped(task, task.Offset) {
+			return
+		}
+	}
+
+	if restarted {
+		// Already had its run at start, if it has one
+	} else if task.RunAtStart {
+		// Still goes through runTask so it holds the lock and can't overlap with the first scheduled run
+		s.startRun(func() { s.runTaskAfterJitter(task) })
+	} else if dueAt, missed := s.missedRunWhileStopped(task, time.Now()); missed {
+		logTaskMessage(levelInfo, task.displayName(), fmt.Sprintf("%s missed its run at %s while the scheduler was stopped. Running it now to catch up", task.displayName(), dueAt.Format(time.RFC3339)))
+		s.startRun(func() { s.runTaskAfterJitter(task) })
+	}
+
+	if task.cron != nil {
+		s.scheduleCronTask(task)
+		return
+	}
+
+	interval := task.Interval
+	thisTicker := time.NewTicker(interval)
+	defer thisTicker.Stop()
+	task.markArmed()
+
+	for {
+		select {
+		case <-thisTicker.C:
+			// Run the task every tick from the channel (Every duration)
+			s.startRun(func() { s.runTaskAfterJitter(task) })
+		case <-task.runFinished:
+			if backedOff := task.backoffInterval(); backedOff != interval {
+				if backedOff > interval {
+					logTaskMessage(levelWarning, task.displayName(), fmt.Sprintf("%s has failed %d times in a row. Backing off to running every %s", task.displayName(), task.failuresInARow(), FormatDuration(backedOff)))
+				} else {
+					logTaskMessage(levelInfo, task.displayName(), fmt.Sprintf("%s succeeded. Going back to running every %s", task.displayName(), FormatDuration(backedOff)))
+				}
+				interval = backedOff
+				thisTicker.Reset(interval)
+			}
+		case <-task.stop:
+			return
+		case <-task.done:
+			return
+		}
+	}
+}
+
+// Schedules a task on its own goroutine, tracked so Wait blocks until every task has stopped. When
+// MaxSchedulingRestarts is set the scheduling is restarted if it panics, waiting longer after each restart
+func (s *Scheduler) startScheduling(task *scheduledTask) {
+	s.active.Add(1)
+	go func() {
+		defer s.active.Done()
+		if s.options.MaxSchedulingRestarts == 0 {
+			s.scheduleTask(task, false)
+			return
+		}
+
+		restartDelay := time.Second
+		for restarts := 0; ; restarts++ {
+			recovered, stack := s.scheduleTaskRecovering(task, restarts > 0)
+			if recovered == nil {
+				return
+			}
+			if restarts == s.options.MaxSchedulingRestarts {
+				logTaskMessage(levelError, task.displayName(), fmt.Sprintf("The scheduling of %s panicked after being restarted %d times, the most allowed. It won't be scheduled again. %v\n%s", task.displayName(), restarts, recovered, stack))
+				return
+			}
+			logTaskMessage(levelError, task.displayName(), fmt.Sprintf("The scheduling of %s panicked. Restarting it in %v (restart %d of %d). %v\n%s", task.displayName(), restartDelay, restarts+1, s.options.MaxSchedulingRestarts, recovered, stack))
+			if !sleepUnlessStopped(task, restartDelay) {
+				return
+			}
+			restartDelay *= 2
+			if restartDelay > time.Minute {
+				restartDelay = time.Minute
+			}
+		}
+	}()
+}
+
+// Schedules a task until it stops, returning what it panicked with and where if it panicked
+func (s *Scheduler) scheduleTaskRecovering(task *scheduledTask, restarted bool) (recovered interface{}, stack []byte) {
+	defer func() {
+		if recovered = recover(); recovered != nil {
+			stack = debug.Stack()
+		}
+	}()
+	s.scheduleTask(task, restarted)
+	return nil, nil
+}
+
+// Runs a task on its own goroutine, tracked so Wait and Stop block until the run has finished
+func (s *Scheduler) startRun(run func()) {
+	s.active.Add(1)
+	go func() {
+		defer s.active.Done()
+		run()
+	}()
+}
+
+// Sleeps for the given duration. Returns false straight away if the task is stopped or runs out of runs in the meantime
+func sleepUnlessStopped(task *scheduledTask, duration time.Duration) bool {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-task.stop:
+		return false
+	case <-task.done:
+		return false
+	}
+}
+
+// Run a task once at its set time and then stop scheduling it
+func (s *Scheduler) scheduleOneOffTask(task *scheduledTask) {
+	waitTime := time.Until(task.At)
+	if _, missed := s.missedRunWhileStopped(task, time.Now()); missed {
+		logTaskMessage(levelInfo, task.displayName(), fmt.Sprintf("%s missed its run at %s while the scheduler was stopped. Running it now to catch up", task.displayName(), task.At.Format(time.RFC3339)))
+		waitTime = 0
+	}
+	if waitTime < 0 {
+		logTaskMessage(levelWarning, task.displayName(), fmt.Sprintf("%s was set to run at %s which has already passed. Skipping this task", task.displayName(), task.At.Format(time.RFC3339)))
+		return
+	}
+
+	task.markArmed()
+	if !sleepUnlessStopped(task, waitTime) {
+		return
+	}
+	if task.isPaused() {
+		logTaskMessage(levelInfo, task.displayName(), fmt.Sprintf("%s is paused. Skipping its run", task.displayName()))
+		return
+	}
+	// Run on this goroutine so the task counts as scheduled until it finishes
+	s.runTask(task)
+}
+
+// Run a task whenever its cron expression matches, sleeping until the next matching time
+func (s *Scheduler) scheduleCronTask(task *scheduledTask) {
+	for {
+		nextRun := task.cron.next(time.Now().In(s.options.Location))
+		if nextRun.IsZero() {
+			logTaskMessage(levelError, task.displayName(), fmt.Sprintf("The cron expression \"%s\" for %s never matches a real date. Not scheduling this task", task.Cron, task.displayName()))
+			return
+		}
+
+		task.markArmed()
+		if !sleepUnlessStopped(task, time.Until(nextRun)) {
+			return
+		}
+		s.startRun(func() { s.runTaskAfterJitter(task) })
+	}
+}
+
+// Waits a random amount of time up to the task's jitter before running it. Runs straight away when there's no jitter,
+// and not at all if the task or the scheduler is stopped during the wait
+func (s *Scheduler) runTaskAfterJitter(task *scheduledTask) {
+	if task.Jitter > 0 {
+		timer := time.NewTimer(s.randomDuration(task.Jitter))
+		defer timer.Stop()
+
+		// Stopping the task or the scheduler shouldn't have to wait out the jitter, or run the task after the stop
+		select {
+		case <-timer.C:
+		case <-task.stop:
+			return
+		case <-s.stopped:
+			return
+		}
+	}
+	if task.isPaused() {
+		logTaskMessage(levelInfo, task.displayName(), fmt.Sprintf("%s is paused. Skipping this run", task.displayName()))
+		return
+	}
+	s.runTask(task)
+}
+
+// Picks how long to wait before retrying a task, its retry delay moved a random amount up to its retry jitter either
+// way. Never below zero, so a jitter bigger than the delay sometimes retries straight away
+func (s *Scheduler) retryDelay(task *scheduledTask) time.Duration {
+	if task.RetryJitter == 0 {
+		return task.RetryDelay
+	}
+	delay := task.RetryDelay - task.RetryJitter + s.randomDuration(2*task.RetryJitter)
+	if delay < 0 {
+		return 0
+	}
+	return delay
+}
+
+// Picks a random duration between 0 and max
+func (s *Scheduler) randomDuration(max time.Duration) time.Duration {
+	s.randomMutex.Lock()
+	defer s.randomMutex.Unlock()
+	return time.Duration(s.random.Int63n(int64(max) + 1))
+}
+
+// A failure from a task that ran without starting a process, like an HTTP task's error response or a built-in task's
+// error. Retried the same as a process exiting with a failure
+type runFailedError struct {
+	err error
+}
+
+func (e *runFailedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *runFailedError) Unwrap() error {
+	return e.err
+}
+
+// Whether a run's error means the task ran and failed, rather than it couldn't be started at all
+func ranAndFailed(err error) bool {
+	var exitErr *exec.ExitError
+	var failedErr *runFailedError
+	return errors.As(err, &exitErr) || errors.As(err, &failedErr)
+}
+
+// Runs a task that could either be a script or a commandline task.
+// Ensures the task is only run once with a mutex lock
+func (s *Scheduler) runTask(task *scheduledTask) {
+	// Deferred first so it runs last, after the locks below have been released
+	defer recoverTaskPanic(task)
+
+	// Lock so no other equivalent task can run at the same time.
+	// Retries happen while the lock is still held so they can't overlap with the next scheduled run
+	if !task.mutex.TryLock() {
+		// The previous run is still going
+		switch task.Overlap {
+		case OverlapSkip:
+			logTaskMessage(levelWarning, task.displayName(), fmt.Sprintf("%s is still running from its last run. Skipping this run", task.displayName()))
+			return
+		case OverlapQueue:
+			logTaskMessage(levelInfo, task.displayName(), fmt.Sprintf("%s is still running from its last run. Queueing this run to start once it finishes", task.displayName()))
+		}
+		task.mutex.Lock()
+	}
+	defer task.mutex.Unlock()
+
+	if s.runContext.Err() != nil {
+		// Queued behind a run that was interrupted while the scheduler was stopping
+		return
+	}
+	if !s.prerequisiteSucceeded(task) {
+		return
+	}
+	if !s.waitForSerialTurn(task) {
+		return
+	}
+	defer s.finishSerialTurn()
+	if !s.acquireRunSlot(task) {
+		return
+	}
+	defer s.releaseRunSlot()
+	if !s.guardAllows(task) {
+		// Checked before the run is counted, so a skipped run doesn't count towards MaxRuns or as a failure
+		return
+	}
+
+	if !task.startCountedRun() {
+		// A run that was already due or queued when the last allowed run started
+		return
+	}
+
+	startedAt := time.Now()
+	task.recordRunStarted()
+	succeeded := false
+	var err error
+	defer func() {
+		if s.runContext.Err() == nil {
+			// An interrupted run says nothing about how long the task takes
+			s.checkRunTime(task, time.Since(startedAt))
+		}
+		if failures := task.recordRunFinished(succeeded); task.MaxFailures > 0 && failures == task.MaxFailures {
+			s.stopFailingTask(task, failures, err)
+		}
+		if succeeded && s.stateFile != nil {
+			s.stateFile.recordSuccess(task.id, startedAt)
+		}
+	}()
+
+	if task.WorkingDir != "" {
+		// Exec's error for a missing directory is confusing, so check it up front
+		if info, err := os.Stat(task.WorkingDir); err != nil || !info.IsDir() {
+			logTaskMessage(levelError, task.displayName(), fmt.Sprintf("The working directory %s for %s doesn't exist or isn't a directory. Skipping this run", task.WorkingDir, task.displayName()))
+			return
+		}
+	}
+
+	s.pingRunStarted(task)
+	totalAttempts := task.Retries + 1
+	for attempt := 1; attempt <= totalAttempts; attempt++ {
+		if attempt > 1 {
+			retryDelay := s.retryDelay(task)
+			logTaskMessage(levelInfo, task.displayName(), fmt.Sprintf("task=%s attempt=%d/%d - Retrying in %s", task.displayName(), attempt, totalAttempts, FormatDuration(retryDelay)))
+			if !s.sleepUnlessInterrupted(retryDelay) {
+				break
+			}
+		}
+
+		err = s.runTaskAttempt(task)
+		succeeded = err == nil
+
+		// Only retry tasks that ran and failed, a task that can't start won't start next time either. Errors from a
+		// runner always mean the task ran
+		if err == nil || (s.options.Runner == nil && !ranAndFailed(err)) || s.runContext.Err() != nil {
+			break
+		}
+		if attempt < totalAttempts && !task.retriesFailure(err) {
+			logTaskMessage(levelInfo, task.displayName(), fmt.Sprintf("task=%s - Not retrying as %s only retries when it exits with %s", task.displayName(), task.displayName(), formatExitCodes(task.RetryOnCodes)))
+			break
+		}
+	}
+	if s.runContext.Err() == nil {
+		s.pingRunFinished(task, succeeded)
+	}
+	if err != nil && s.runContext.Err() == nil {
+		s.notifyFailure(task, err)
+	}
+}
+
+// Stops scheduling a task once MaxFailures of its runs in a row have failed, so a task that's broken doesn't keep
+// running until someone notices. Runs through the HTTP API still work, but don't start it being scheduled again
+func (s *Scheduler) stopFailingTask(task *scheduledTask, failures int, runErr error) {
+	logTaskMessage(levelError, task.displayName(), fmt.Sprintf("%s has failed %d times in a row, the most set by its max failures. It won't be scheduled again until it's changed by a reload or the scheduler restarts", task.displayName(), failures))
+	task.stopScheduling()
+	s.notifyStopped(task, failures, runErr)
+}
+
+// Applies the task's nice value and IO priority to the process group of a run that has just started. A priority that
+// can't be set is logged and the run carries on without it
+func (s *Scheduler) setProcessPriority(task *scheduledTask, pid int) {
+	if task.Nice != 0 {
+		if err := setNice(pid, task.Nice); err != nil {
+			logTaskMessage(levelWarning, task.displayName(), fmt.Sprintf("Failed to set the nice value of %s to %d, running it with the scheduler's. %v", task.displayName(), task.Nice, err))
+		}
+	}
+	if task.IONice != "" {
+		if err := setIOPriority(pid, task.ioPriority); err != nil {
+			logTaskMessage(levelWarning, task.displayName(), fmt.Sprintf("Failed to set the IO priority of %s to %s, running it with the scheduler's. %v", task.displayName(), task.IONice, err))
+		}
+	}
+}
+
+// Sleeps for the given duration. Returns false straight away if the scheduler's runs are interrupted in the meantime
+func (s *Scheduler) sleepUnlessInterrupted(duration time.Duration) bool {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-s.runContext.Done():
+		return false
+	}
+}
+
+// Warns when a run took longer than the task's interval, as its runs will start piling up if that keeps happening.
+// Doesn't change how the task is scheduled
+func (s *Scheduler) checkRunTime(task *scheduledTask, elapsed time.Duration) {
+	average := task.recordRunTime(elapsed)
+	if task.Interval == 0 || elapsed <= task.Interval {
+		return
+	}
+	logTaskMessage(levelWarning, task.displayName(), fmt.Sprintf("%s took %v but runs every %s, so its runs may overlap. Its runs take %v on average", task.displayName(), formatRunDuration(elapsed), FormatDuration(task.Interval), formatRunDuration(average)))
+}
+
+// Stops a panic in a task's run from crashing the whole scheduler, logging it so the bug can be tracked down
+func recoverTaskPanic(task *scheduledTask) {
+	if recovered := recover(); recovered != nil {
+		logTaskMessage(levelError, task.displayName(), fmt.Sprintf("%s panicked while running and was stopped. Other tasks will keep running. %v\n%s", task.displayName(), recovered, debug.Stack()))
+	}
+}
+
+// Waits for a free slot when MaxConcurrent is set, behind any waiting runs with a higher priority. Tasks using the
+// skip overlap mode don't wait, returning false so the run can be skipped instead, as it is if the scheduler stops
+// while the run is waiting
+func (s *Scheduler) acquireRunSlot(task *scheduledTask) bool {
+	if s.runSlots == nil || s.runSlots.tryTurn() {
+		return true
+	}
+
+	if task.Overlap == OverlapSkip {
+		logTaskMessage(levelWarning, task.displayName(), fmt.Sprintf("%s can't start as %d tasks are already running, the most allowed by --max-concurrent. Skipping this run", task.displayName(), s.runSlots.limit))
+		return false
+	}
+	logTaskMessage(levelInfo, task.displayName(), fmt.Sprintf("%s is waiting to start as %d tasks are already running, the most allowed by --max-concurrent", task.displayName(), s.runSlots.limit))
+	if !s.runSlots.waitForTurn(task.Priority, s.stopped) {
+		logTaskMessage(levelInfo, task.displayName(), fmt.Sprintf("%s was still waiting to start when the scheduler stopped. Skipping this run", task.displayName()))
+		return false
+	}
+	return true
+}
+
+// Frees the slot taken by acquireRunSlot
+func (s *Scheduler) releaseRunSlot() {
+	if s.runSlots != nil {
+		s.runSlots.finishTurn()
+	}
+}
+
+// Runs a single attempt of a task, applying its timeout to this attempt only
+func (s *Scheduler) runTaskAttempt(task *scheduledTask) error {
+	ctx := s.runContext
+	if task.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, task.Timeout)
+		defer cancel()
+	}
+
+	if task.builtin != nil {
+		// Built into the scheduler, so they run the same way whatever runs the other tasks
+		return s.runBuiltinTask(task)
+	}
+	if s.options.Runner != nil {
+		return s.runWithRunner(ctx, task)
+	}
+	if task.HTTP {
+		return s.runHTTPTask(ctx, task)
+	}
+	if task.scriptType != "" {
+		return s.runScriptFile(ctx, task)
+	}
+	return s.runCustomCommand(ctx, task)
+}
+
+// Runs a task with the runner from the options instead of starting a process, logging how it went the same way
+func (s *Scheduler) runWithRunner(ctx context.Context, task *scheduledTask) error {
+	taskName := task.displayName()
+
+	if task.Verbosity == VerbosityVerbose {
+		logTaskMessage(levelInfo, taskName, fmt.Sprintf("task=%s - Running with the runner", taskName))
+	}
+	s.metrics.runStarted(task.id, taskName, task.Labels)
+	startTime := time.Now()
+	err := s.options.Runner(ctx, task.status().Task)
+	elapsed := time.Since(startTime)
+	s.metrics.runFinished(task.id, elapsed, err == nil)
+	task.recordHistory(newRunRecord(startTime, elapsed, false, err, "", ""), s.options.HistorySize)
+	durationMs := elapsed.Milliseconds()
+	duration := formatRunDuration(elapsed)
+
+	entry := logEntry{Task: taskName, DurationMs: &durationMs}
+	if err != nil {
+		entry.Level = levelError
+		if s.runContext.Err() != nil {
+			entry.Message = fmt.Sprintf("%s was interrupted as the scheduler stopped", taskName)
+			writeTaskLog(task, entry, fmt.Sprintf("ERROR!: %s duration=%s. %v", entry.Message, duration, err))
+			return err
+		}
+		if ctx.Err() == context.DeadlineExceeded {
+			entry.Message = fmt.Sprintf("%s ran longer than its timeout of %v and was stopped", taskName, task.Timeout)
+			writeTaskLog(task, entry, fmt.Sprintf("ERROR!: %s duration=%s. %v", entry.Message, duration, err))
+			return err
+		}
+		entry.Message = fmt.Sprintf("Task failed: %v", err)
+		writeTaskLog(task, entry, fmt.Sprintf("ERROR!: task=%s duration=%s - %v", taskName, duration, err))
+		return err
+	}
+
+	if task.Verbosity == VerbosityQuiet {
+		return nil
+	}
+	entry.Level = levelInfo
+	entry.Message = "Task succeeded"
+	writeTaskLog(task, entry, fmt.Sprintf("%s duration=%s - succeeded", taskName, duration))
+	return nil
+}
+
+// Runs a command line task. Only allows one of the task to run at a time
+func (s *Scheduler) runCustomCommand(ctx context.Context, task *scheduledTask) error {
+	if s.options.UseShell {
+		shell, err := commandShell(s.options.Shell)
+		if err != nil {
+			return err
+		}
+		cmd := exec.CommandContext(ctx, shell[0], append(shell[1:], task.Command)...)
+		return s.runAndLogTask(ctx, cmd, task)
+	}
+
+	// Split the command up into the values so exec can find the right executable to run
+	program, args := parseCommandLine(task.Command)
+	cmd := exec.CommandContext(ctx, program, args...)
+	return s.runAndLogTask(ctx, cmd, task)
+}
+
+// Splits a command into the program to run and its arguments, the same way a shell would.
+// Single quotes keep everything inside them as is, double quotes allow \" and \\ escapes,
+// and outside of quotes a backslash escapes the next character (e.g. a space)
+func parseCommandLine(command string) (string, []string) {
+	var values []string
+	var current strings.Builder
+	// Tracks whether the current value has started, so empty quoted values ("") are still kept
+	inValue := false
+	var quote rune
+	escaped := false
+
+	chars := []rune(command)
+	for i, char := range chars {
+		switch {
+		case escaped:
+			current.WriteRune(char)
+			escaped = false
+		case quote == '\'':
+			if char == '\'' {
+				quote = 0
+			} else {
+				current.WriteRune(char)
+			}
+		case quote == '"':
+			if char == '"' {
+				quote = 0
+			} else if char == '\\' && i+1 < len(chars) && (chars[i+1] == '"' || chars[i+1] == '\\') {
+				// Any other backslash is kept as is so paths like "C:\scripts" still work
+				escaped = true
+			} else {
+				current.WriteRune(char)
+			}
+		case char == '\'' || char == '"':
+			quote = char
+			inValue = true
+		case char == '\\':
+			escaped = true
+			inValue = true
+		case char == ' ' || char == '\t':
+			if inValue {
+				values = append(values, current.String())
+				current.Reset()
+				inValue = false
+			}
+		default:
+			current.WriteRune(char)
+			inValue = true
+		}
+	}
+
+	if inValue {
+		values = append(values, current.String())
+	}
+
+	if len(values) == 0 {
+		return "", nil
+	}
+	return values[0], values[1:]
+}
+
+// Runs a script file with the right interpreter for its type. Only allows one of the scripts to execute at a time
+func (s *Scheduler) runScriptFile(ctx context.Context, task *scheduledTask) error {
+	interpreter, err := scriptInterpreter(task.Command, task.scriptType, s.options.Shell)
+	if err != nil {
+		logTaskMessage(levelError, task.displayName(), fmt.Sprintf("Can't run %s. %v", task.displayName(), err))
+		return err
+	}
+
+	args := append(interpreter[1:], task.Command)
+	cmd := exec.CommandContext(ctx, interpreter[0], args...)
+	return s.runAndLogTask(ctx, cmd, task)
+}
+
+// Opens a task's output file for a run, truncating or appending to it depending on the task's output file mode
+func openOutputFile(task *scheduledTask) (*os.File, error) {
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if task.OutputFileMode == OutputFileAppend {
+		flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+	return os.OpenFile(task.OutputFile, flags, 0644)
+}
+
+// The content to feed a task's run on stdin. Stdin starting with @ is the path of a file to read it from, read on every
+// run so changes to the file are picked up
+func taskStdin(task *scheduledTask) (string, error) {
+	if !strings.HasPrefix(task.Stdin, "@") {
+		return task.Stdin, nil
+	}
+	content, err := os.ReadFile(strings.TrimPrefix(task.Stdin, "@"))
+	if err != nil {
+		return "", err
+	}
+	return string(content), nil
+}
+
+// The env vars a task's processes get on top of the scheduler's, from its env file and then its own env
+func taskEnv(task *scheduledTask) ([]string, error) {
+	if task.EnvFile == "" {
+		return task.Env, nil
+	}
+	fileEnv, err := readEnvFile(task.EnvFile)
+	if err != nil {
+		return nil, err
+	}
+	// Later vars win, so the task's own env overrides the file's
+	return append(fileEnv, task.Env...), nil
+}
+
+// Runs and logs a predefined user task or script. Returns the error if the task failed
+func (s *Scheduler) runAndLogTask(ctx context.Context, cmd *exec.Cmd, task *scheduledTask) error {
+	taskName := task.displayName()
+
+	cmd.Dir = task.WorkingDir
+	env, err := taskEnv(task)
+	if err != nil {
+		logTaskMessage(levelError, taskName, fmt.Sprintf("The env file of %s couldn't be loaded. Skipping this run. %v", taskName, err))
+		return err
+	}
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	if task.Stdin != "" {
+		stdin, err := taskStdin(task)
+		if err != nil {
+			logTaskMessage(levelError, taskName, fmt.Sprintf("The stdin of %s couldn't be read. Skipping this run. %v", taskName, err))
+			return err
+		}
+		cmd.Stdin = strings.NewReader(stdin)
+	}
+
+	// Bind the output to new buffers, keeping stderr separate so failures can show their diagnostics. Merged output
+	// shares one buffer so it stays in the order it was written, exec makes sure only one write happens at a time
+	maxOutputBytes := s.options.MaxOutputBytes
+	if maxOutputBytes == 0 {
+		maxOutputBytes = defaultMaxOutputBytes
+	}
+	out := newBoundedBuffer(maxOutputBytes)
+	errOut := newBoundedBuffer(maxOutputBytes)
+	cmd.Stdout = out
+	cmd.Stderr = errOut
+	if s.options.MergeOutput {
+		cmd.Stderr = out
+	}
+	// Streamed output is logged as it's written, so it isn't buffered at all
+	var streamers []*outputStreamer
+	if s.options.StreamOutput {
+		stdoutStreamer := newOutputStreamer(task, "stdout", s.options.MaxOutputBytes)
+		stderrStreamer := newOutputStreamer(task, "stderr", s.options.MaxOutputBytes)
+		if s.options.MergeOutput {
+			stdoutStreamer.source = "output"
+			stderrStreamer = stdoutStreamer
+		}
+		streamers = []*outputStreamer{stdoutStreamer, stderrStreamer}
+		cmd.Stdout = stdoutStreamer
+		cmd.Stderr = stderrStreamer
+	}
+	if task.OutputFile != "" {
+		// Not being able to write the output somewhere isn't a reason to skip the run, so it's logged as usual instead
+		outputFile, err := openOutputFile(task)
+		if err != nil {
+			logTaskMessage(levelWarning, taskName, fmt.Sprintf("task=%s - Couldn't open the output file so stdout will be logged instead. %v", taskName, err))
+		} else {
+			defer outputFile.Close()
+			cmd.Stdout = outputFile
+		}
+	}
+
+	// Make sure anything the task started is killed along with it when it times out or is interrupted
+	killProcessGroupOnCancel(cmd)
+	if task.credential != nil {
+		setRunAs(cmd, task.credential)
+	}
+
+	if task.Verbosity == VerbosityVerbose {
+		logTaskMessage(levelInfo, taskName, fmt.Sprintf("task=%s - Running %s", taskName, cmd.String()))
+	}
+	s.metrics.runStarted(task.id, taskName, task.Labels)
+	startTime := time.Now()
+	err = cmd.Start()
+	if err == nil {
+		s.setProcessPriority(task, cmd.Process.Pid)
+		err = cmd.Wait()
+	}
+	elapsed := time.Since(startTime)
+	for _, streamer := range streamers {
+		streamer.Flush()
+	}
+	s.metrics.runFinished(task.id, elapsed, err == nil)
+	task.recordHistory(newRunRecord(startTime, elapsed, true, err, out.String(), errOut.String()), s.options.HistorySize)
+	durationMs := elapsed.Milliseconds()
+	duration := formatRunDuration(elapsed)
+
+	entry := logEntry{
+		Task:       taskName,
+		DurationMs: &durationMs,
+		Stdout:     out.String(),
+		Stderr:     errOut.String(),
+	}
+
+	// What failures show to explain themselves. Merged output has stderr mixed in with the rest, and streamed output
+	// has already been logged
+	diagnostics := ". stderr: " + errOut.String()
+	switch {
+	case s.options.StreamOutput:
+		diagnostics = ""
+	case s.options.MergeOutput:
+		diagnostics = ". output: " + out.String()
+	}
+
+	if err != nil {
+		entry.Level = levelError
+		// Keep the output with the error so failure notifications can show it
+		stderr := errOut.String()
+		if s.options.MergeOutput {
+			stderr = out.String()
+		}
+		err = &runOutputError{err: err, stderr: stderr}
+
+		var exitErr *exec.ExitError
+		isExitErr := errors.As(err, &exitErr)
+		if isExitErr {
+			exitCode := exitErr.ExitCode()
+			entry.ExitCode = &exitCode
+		}
+
+		if s.runContext.Err() != nil {
+			entry.Message = fmt.Sprintf("%s was interrupted as the scheduler stopped and was killed", taskName)
+			writeTaskLog(task, entry, fmt.Sprintf("ERROR!: %s duration=%s%s", entry.Message, duration, diagnostics))
+			return err
+		}
+		if ctx.Err() == context.DeadlineExceeded {
+			entry.Message = fmt.Sprintf("%s ran longer than its timeout of %v and was killed", taskName, task.Timeout)
+			writeTaskLog(task, entry, fmt.Sprintf("ERROR!: %s duration=%s%s", entry.Message, duration, diagnostics))
+			return err
+		}
+		// Task failed, print the failure to the logs and exit
+		if isExitErr {
+			// The task ran but exited with a failure code
+			entry.Message = fmt.Sprintf("Task failed: %v", err)
+			writeTaskLog(task, entry, fmt.Sprintf("ERROR!: task=%s exit_code=%d duration=%s - %v%s", taskName, exitErr.ExitCode(), duration, err, diagnostics))
+		} else {
+			// The task never got to run (binary not found, permission denied etc.)
+			reason := err.Error()
+			if task.credential != nil && errors.Is(err, os.ErrPermission) {
+				reason += ". Running a task as another user or group needs the scheduler to be running as root"
+			}
+			entry.Message = fmt.Sprintf("Task failed to start: %s", reason)
+			writeTaskLog(task, entry, fmt.Sprintf("ERROR!: task=%s start_failed duration=%s - %s", taskName, duration, reason))
+		}
+		return err
+	}
+
+	// Quiet tasks only log their failures
+	if task.Verbosity == VerbosityQuiet {
+		return nil
+	}
+
+	// Succeeded, print the response in a human readable log format
+	exitCode := 0
+	entry.Level = levelInfo
+	entry.ExitCode = &exitCode
+	entry.Message = "Task succeeded"
+	if s.options.StreamOutput {
+		writeTaskLog(task, entry, fmt.Sprintf("%s duration=%s - succeeded", taskName, duration))
+		return nil
+	}
+	if errOut.Len() > 0 {
+		writeTaskLog(task, entry, fmt.Sprintf("%s duration=%s - %s. stderr: %s", taskName, duration, out.String(), errOut.String()))
+		return nil
+	}
+	writeTaskLog(task, entry, fmt.Sprintf("%s duration=%s - %s", taskName, duration, out.String()))
+	return nil
+}
+
+// Formats how long a run took for the text logs, rounded so fast runs don't show down to the nanosecond
+func formatRunDuration(elapsed time.Duration) string {
+	return elapsed.Round(time.Microsecond).String()
+}
+
+// Formats an interval or delay for logs and listings, rounded to the second and without the zero units
+// time.Duration's String leaves in (e.g. 1h rather than 1h0m0s). Anything under a second is shown as it is. Only for
+// showing durations, the exact duration is still used for scheduling
+func FormatDuration(duration time.Duration) string {
+	if duration < time.Second {
+		return duration.String()
+	}
+	duration = duration.Round(time.Second)
+
+	var formatted strings.Builder
+	if hours := duration / time.Hour; hours > 0 {
+		fmt.Fprintf(&formatted, "%dh", hours)
+	}
+	if minutes := duration % time.Hour / time.Minute; minutes > 0 {
+		fmt.Fprintf(&formatted, "%dm", minutes)
+	}
+	if seconds := duration % time.Minute / time.Second; seconds > 0 {
+		fmt.Fprintf(&formatted, "%ds", seconds)
+	}
+	return formatted.String()
+}
+
+// Formats a list of exit codes for log messages, e.g. "1, 2 or 75"
+func formatExitCodes(codes []int) string {
+	formatted := make([]string, len(codes))
+	for i, code := range codes {
+		formatted[i] = strconv.Itoa(code)
+	}
+	if len(formatted) == 1 {
+		return formatted[0]
+	}
+	return strings.Join(formatted[:len(formatted)-1], ", ") + " or " + formatted[len(formatted)-1]
+}
@@ -0,0 +1,154 @@
+package scheduler
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// A buffer the log can be written to from many goroutines while the test reads it
+type syncBuffer struct {
+	mutex  sync.Mutex
+	buffer bytes.Buffer
+}
+
+func (b *syncBuffer) Write(data []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buffer.Write(data)
+}
+
+func (b *syncBuffer) String() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buffer.String()
+}
+
+func TestPanickingTaskDoesNotStopTheScheduler(t *testing.T) {
+	logs := &syncBuffer{}
+	log.SetOutput(logs)
+	defer log.SetOutput(os.Stderr)
+
+	var panics, healthyRuns atomic.Int64
+	taskScheduler, err := New(Options{
+		Runner: func(ctx context.Context, task Task) error {
+			if task.Name == "panics" {
+				panics.Add(1)
+				panic("something went wrong")
+			}
+			healthyRuns.Add(1)
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	for _, name := range []string{"panics", "healthy"} {
+		if err := taskScheduler.AddTask(Task{Name: name, Command: name, Interval: 10 * time.Millisecond}); err != nil {
+			t.Fatalf("AddTask(%s) failed: %v", name, err)
+		}
+	}
+
+	if err := taskScheduler.Start(context.Background()); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer taskScheduler.Stop()
+
+	// The panicking task has to panic more than once, so its own scheduling survives it too
+	deadline := time.Now().Add(5 * time.Second)
+	for panics.Load() < 3 || healthyRuns.Load() < 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("only %d panics and %d healthy runs happened before the deadline", panics.Load(), healthyRuns.Load())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if output := logs.String(); !strings.Contains(output, "panics panicked while running") || !strings.Contains(output, "something went wrong") {
+		t.Errorf("expected the panic to be logged with the task's name, got:\n%s", output)
+	}
+}
+
+func TestFailedRunsWithoutAProcessAreRetried(t *testing.T) {
+	logs := &syncBuffer{}
+	log.SetOutput(logs)
+	defer log.SetOutput(os.Stderr)
+
+	var requests atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	taskScheduler, err := New(Options{})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	// @state-save fails without a state file
+	tasks := []Task{
+		{Name: "http", Command: server.URL, HTTP: true, Interval: time.Hour, Retries: 2},
+		{Name: "builtin", Command: "@state-save", Interval: time.Hour, Retries: 2},
+	}
+	for _, task := range tasks {
+		if err := taskScheduler.AddTask(task); err != nil {
+			t.Fatalf("AddTask(%s) failed: %v", task.Name, err)
+		}
+	}
+	results, err := taskScheduler.RunOnce(context.Background())
+	if err != nil {
+		t.Fatalf("RunOnce failed: %v", err)
+	}
+
+	if requests.Load() != 3 {
+		t.Errorf("expected the HTTP task to send 3 requests with 2 retries, got %d", requests.Load())
+	}
+	for _, result := range results {
+		if result.Status != StatusFailure {
+			t.Errorf("expected %s to fail, got %s", result.ID, result.Status)
+		}
+	}
+	if builtinRuns := strings.Count(logs.String(), "task=builtin duration="); builtinRuns != 3 {
+		t.Errorf("expected the built-in task to run 3 times with 2 retries, got %d:\n%s", builtinRuns, logs.String())
+	}
+}
+
+func TestStopDuringJitterSkipsTheRun(t *testing.T) {
+	var runs atomic.Int64
+	taskScheduler, err := New(Options{
+		Runner: func(ctx context.Context, task Task) error {
+			runs.Add(1)
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if err := taskScheduler.AddTask(Task{Name: "jittery", Command: "jittery", Interval: time.Hour, Jitter: time.Hour, RunAtStart: true}); err != nil {
+		t.Fatalf("AddTask failed: %v", err)
+	}
+	if err := taskScheduler.Start(context.Background()); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		taskScheduler.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stop waited out the task's jitter")
+	}
+	if runs.Load() != 0 {
+		t.Errorf("expected the run waiting out its jitter to be skipped, it ran %d times", runs.Load())
+	}
+}
@@ -0,0 +1,968 @@
+// Package scheduler runs commands and scripts on a schedule, either every fixed interval, whenever a cron expression
+// matches or once at a set time. It's what the task-scheduler command is built on and can be used from other programs
+// to schedule tasks without going through the command line
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// A task to run on a schedule. Exactly one of Interval, Cron or At needs to be set
+type Task struct {
+	// An optional name for the task used in logs instead of the command. Needs to be unique within a scheduler
+	Name string
+	// A command, or a path to a local script file (.sh, .ps1, .py, or .bat and .cmd on Windows)
+	Command string
+	// How long to wait between runs
+	Interval time.Duration
+	// A five field cron expression (minute hour day-of-month month day-of-week) for when the task runs, or six fields
+	// with seconds first
+	Cron string
+	// A time to run the task once at instead of repeating it
+	At time.Time
+	// How long the task can run before it's killed. Zero means no timeout
+	Timeout time.Duration
+	// How many more times to run the task if it fails, and how long to wait between each attempt
+	Retries    int
+	RetryDelay time.Duration
+	// How far each retry's delay can randomly move either way from RetryDelay, so many schedulers retrying the same
+	// failing dependency don't all retry at once. The delay never goes below zero
+	RetryJitter time.Duration
+	// The exit codes that a failed run is retried for. Runs that fail any other way aren't retried. Empty retries any
+	// failure
+	RetryOnCodes []int
+	// What to do when a run is due while the previous one is still going. One of the overlap modes, defaults to
+	// OverlapWait
+	Overlap string
+	// How much of the task's runs are logged. One of the verbosity levels, defaults to VerbosityNormal
+	Verbosity string
+	// The most a run can be randomly delayed by, to stop tasks on the same schedule all starting at once
+	Jitter time.Duration
+	// How long to wait before the task's schedule starts, so tasks on the same interval can be staggered by a fixed
+	// amount. Delays the run at start too. Only applies to tasks with an Interval
+	Offset time.Duration
+	// Whether to run the task straight away instead of waiting for its first scheduled time
+	RunAtStart bool
+	// How many times the task can run before it stops being scheduled. Zero means it runs until the scheduler stops
+	MaxRuns int
+	// How many runs in a row can fail before the task stops being scheduled. Zero means it keeps running however many
+	// fail
+	MaxFailures int
+	// How many runs in a row need to fail before the task's interval starts backing off, doubling with every further
+	// failure until a run succeeds. Zero means the interval never changes. Only applies to tasks with an Interval
+	BackoffAfter int
+	// The longest the interval can back off to. Defaults to 16 times the interval
+	BackoffMax time.Duration
+	// Whether Command is an HTTP request to send directly instead of a program to run, written as "METHOD URL" (e.g.
+	// "POST https://example.com/refresh"). A lone URL sends a GET. Responses outside 2xx fail the run
+	HTTP bool
+	// The user:password to send with an HTTP task's request as basic auth. Empty sends no credentials
+	HTTPBasicAuth string
+	// The directory to run the task in and any extra environment variables (KEY=VALUE) to give it
+	WorkingDir string
+	Env        []string
+	// A dotenv file of more environment variables to give the task, read before every run so changes to it are picked
+	// up. Env takes precedence over it
+	EnvFile string
+	// What to feed the task's processes on stdin, e.g. a query for psql. Starting with @ reads it from the file at the
+	// rest of the path on every run instead, and a run is skipped if the file can't be read. Empty gives no stdin. Not
+	// used by HTTP tasks
+	Stdin string
+	// The user and group to run the task's processes as, by name or id. Empty keeps the scheduler's own. Only
+	// supported on Unix, and the scheduler needs to be running as root to switch to them
+	User  string
+	Group string
+	// The CPU niceness to run the task's processes with, from -20 (most favoured) to 19 (least favoured). Zero keeps
+	// the scheduler's own. Only supported on Unix, and lowering it below the scheduler's needs root
+	Nice int
+	// The IO scheduling class and level to run the task's processes with, like ionice(1): "idle", "best-effort:<0-7>"
+	// or "realtime:<0-7>", where lower levels are favoured. Empty keeps the scheduler's own. Only supported on Linux
+	IONice string
+	// A file to write the task's stdout to instead of the log, opened on every run. OutputFileMode says whether each
+	// run truncates it or appends to it, defaulting to truncate. Empty logs stdout as usual
+	OutputFile     string
+	OutputFileMode string
+	// The id of another task in the scheduler that has to have succeeded on its most recent run for this task to run.
+	// Runs that are due while it hasn't are skipped. Empty means the task doesn't depend on any other
+	After string
+	// A command to run before each run, which has to exit successfully for the run to go ahead, e.g. a check that
+	// there's enough disk space. Runs that don't pass are skipped. Runs with the task's timeout, directory, env file
+	// and env. Empty always runs the task
+	Guard string
+	// Extra labels for the task, e.g. team=infra, added to its metrics and shown by the HTTP API, where tasks can be
+	// filtered by them. Names need to be valid Prometheus label names
+	Labels map[string]string
+	// A URL to send a GET to after every successful run, for a Healthchecks.io style service to alert when the pings
+	// stop. With PingStartAndFail the URL is also pinged with /start added when a run starts and /fail added when a
+	// run fails. Pings are best effort, failures are logged. Empty sends no pings
+	PingURL          string
+	PingStartAndFail bool
+	// Which of the runs waiting for a turn under Serial or MaxConcurrent goes first, highest first. Runs with the same
+	// priority go in the order they started waiting. Zero by default, so every task is equal unless it's given one
+	Priority int
+	// Disabled tasks are kept in the scheduler and listed but never scheduled, so they can be turned off without
+	// removing them
+	Disabled bool
+}
+
+// The name used for the task in logs. Falls back to the command when the task wasn't named
+func (t Task) displayName() string {
+	if t.Name != "" {
+		return t.Name
+	}
+	return t.Command
+}
+
+// What a task does when it's due to run while its previous run is still going
+const (
+	// Wait for the previous run to finish then run straight after it
+	OverlapWait = "wait"
+	// The same as wait, but logs that the run was queued so late runs can be spotted
+	OverlapQueue = "queue"
+	// Don't run at all, wait for the next scheduled time instead
+	OverlapSkip = "skip"
+)
+
+// Checks the overlap mode is one of the supported modes
+func ValidateOverlapMode(mode string) error {
+	switch mode {
+	case OverlapWait, OverlapQueue, OverlapSkip:
+		return nil
+	}
+	return fmt.Errorf("unknown overlap mode \"%s\", expected skip, queue or wait", mode)
+}
+
+// What a run does to a task's output file
+const (
+	// Replace the file's contents so it only holds the latest run's output
+	OutputFileTruncate = "truncate"
+	// Add to the end of the file so it holds the output of every run
+	OutputFileAppend = "append"
+)
+
+// Checks the output file mode is one of the supported modes
+func ValidateOutputFileMode(mode string) error {
+	switch mode {
+	case OutputFileTruncate, OutputFileAppend:
+		return nil
+	}
+	return fmt.Errorf("unknown output file mode \"%s\", expected truncate or append", mode)
+}
+
+// How much of a task's runs are logged
+const (
+	// Only log runs that fail
+	VerbosityQuiet = "quiet"
+	// Log every run along with its output
+	VerbosityNormal = "normal"
+	// The same as normal, but also logs the command being run before each run
+	VerbosityVerbose = "verbose"
+)
+
+// Checks the verbosity is one of the supported levels
+func ValidateVerbosity(verbosity string) error {
+	switch verbosity {
+	case VerbosityQuiet, VerbosityNormal, VerbosityVerbose:
+		return nil
+	}
+	return fmt.Errorf("unknown verbosity \"%s\", expected quiet, normal or verbose", verbosity)
+}
+
+// The status of a task's most recent run. Empty means it hasn't run yet
+const (
+	StatusRunning = "running"
+	StatusSuccess = "success"
+	StatusFailure = "failure"
+	// Only used by RunOnce, for tasks that were disabled, needed a prerequisite that didn't succeed or were left
+	// over when the scheduler was stopped
+	StatusSkipped = "skipped"
+)
+
+// Settings that apply to every task in a scheduler. The zero value runs tasks with no limits and saves nothing to disk
+type Options struct {
+	// The most tasks that can run at the same time. Zero means no limit
+	MaxConcurrent int
+	// Whether to only ever run one task at a time, starting runs in the order they became due. Runs still queued when
+	// the scheduler stops are skipped
+	Serial bool
+	// A file to save the time each task last succeeded in, as JSON. Empty means nothing is saved
+	StateFile string
+	// Whether to run tasks straight away on start if they missed a run while the scheduler was stopped, based on the
+	// times in StateFile
+	CatchUp bool
+	// The shell to run .sh scripts with. Defaults to $SHELL, then bash from the PATH
+	Shell string
+	// Whether to run commands through a shell so they can use pipes, globs, && etc, instead of starting their program
+	// directly. Uses Shell with -c, defaulting to sh (cmd /C on Windows). Scripts aren't affected
+	UseShell bool
+	// The timezone cron expressions are matched in. Defaults to the host's local time
+	Location *time.Location
+	// A directory to also write each task's runs to, in a file per task named after the task. Empty means tasks are
+	// only logged to the main log
+	TaskLogDir string
+	// The size in bytes each task's log file can grow to before it's rotated, and how many rotated files to keep
+	TaskLogMaxSize    int64
+	TaskLogMaxBackups int
+	// Whether to capture stdout and stderr together in the order they were written instead of separately. The merged
+	// output is logged as stdout
+	MergeOutput bool
+	// Whether to log each line of a task's output as soon as it's written, instead of all together once the run
+	// finishes. Lines are marked with the task and whether they came from stdout or stderr
+	StreamOutput bool
+	// The most bytes of each of a task's stdout and stderr to keep from a run, anything past it is cut off.
+	// Zero keeps up to 1MB and a negative number keeps everything
+	MaxOutputBytes int64
+	// How long Stop waits for running tasks to finish before interrupting them, killing their processes and
+	// cancelling the context given to Runner. Zero waits for them to finish however long they take
+	ShutdownGracePeriod time.Duration
+	// A Slack incoming webhook URL to post a message to whenever a task fails, once it has used up its retries.
+	// Empty means no messages are sent
+	SlackWebhookURL string
+	// The seed for the random delays picked for jitter and retry jitter, so they're the same every time the scheduler
+	// starts. Only meant for testing, as every start picking the same delays defeats the point of spreading runs out.
+	// Zero seeds it from the time so every start picks different delays
+	Seed int64
+	// How many times a task's scheduling is restarted if it panics, waiting from a second up to a minute longer before
+	// each restart. A run panicking doesn't count, runs recover by themselves. Zero lets the panic crash the program
+	MaxSchedulingRestarts int
+	// How many of each task's most recent runs to keep in memory, along with the end of their output, for the HTTP
+	// API's logs endpoint. Zero keeps none
+	HistorySize int
+	// A URL to post a JSON message to when a task stops being scheduled because too many of its runs failed in a row.
+	// Empty means no messages are sent
+	MaxFailuresWebhookURL string
+	// Called to run a task in place of starting its command or script, e.g. to run a Go function on a schedule.
+	// The context is cancelled when the task's timeout is reached. Returning an error counts as a failed run and is
+	// retried like one. Nil runs each task's command as a process
+	Runner func(ctx context.Context, task Task) error
+}
+
+// Runs tasks on their schedules. Tasks can be added before or after the scheduler is started
+type Scheduler struct {
+	options Options
+	// Guards the task list and whether the scheduler has started, as both can change while tasks are running
+	tasksMutex sync.Mutex
+	tasks      []*scheduledTask
+	started    bool
+	// The tasks the scheduler was started with, ready once they've all been scheduled
+	initialTasks []*scheduledTask
+	// Closed when the scheduler is stopped
+	stopped  chan struct{}
+	stopOnce sync.Once
+	// Limits how many tasks can run at once when MaxConcurrent is set, each running task holds one slot.
+	// Nil means there's no limit
+	runSlots *runQueue
+	// The random source for jitter. Rand isn't safe to use from many goroutines so it's guarded by a mutex
+	random      *rand.Rand
+	randomMutex sync.Mutex
+	// Queues every run so they run one at a time when Serial is set. Nil means runs don't wait for each other
+	serialRuns *runQueue
+	// Remembers when each task last succeeded so missed runs can be caught up on. Nil when StateFile isn't set
+	stateFile *taskStateFile
+	metrics   *taskMetrics
+	// Tracks every task being scheduled and every run that's going, so Wait and Stop can block until they've finished
+	active sync.WaitGroup
+	// The context every run is started with. Cancelled to interrupt the runs still going when stopping takes longer
+	// than the shutdown grace period
+	runContext context.Context
+	cancelRuns context.CancelFunc
+}
+
+// A task added to a scheduler along with everything tracked while it's scheduled
+type scheduledTask struct {
+	Task
+	// The extension of the script file the task runs (e.g. ".sh"), or empty if the task is a command
+	scriptType string
+	cron       *cronSchedule
+	mutex      *sync.Mutex
+	// A name unique across every task in the scheduler, used to refer to the task in the HTTP API
+	id string
+	// What's known about the task's runs. Read by the HTTP API while the task runs, so it has its own lock
+	stateMutex sync.Mutex
+	lastRun    time.Time
+	lastStatus string
+	// Paused tasks keep their schedule but skip their scheduled runs until they're resumed
+	paused bool
+	// How many runs in a row have failed, used to back off the interval
+	consecutiveFailures int
+	// A moving average of how long the task's runs take, including retries. Zero until the first run finishes
+	averageRunTime time.Duration
+	// The task's most recent runs, up to the history size in the options
+	history runHistory
+	// Signalled after every run so the interval can be backed off or reset
+	runFinished chan struct{}
+	// How many times the task has run, counted when each run starts. Closes done once it reaches MaxRuns, or once
+	// MaxFailures runs in a row have failed
+	runCount atomic.Int64
+	done     chan struct{}
+	doneOnce sync.Once
+	// How many of the task's runs have finished succeeding or failing, after any retries
+	successCount atomic.Int64
+	failureCount atomic.Int64
+	// Where the task's runs are logged as well as the main log when there's a task log directory
+	outputLog     *log.Logger
+	outputLogFile *RotatingLogFile
+	// Closed to stop scheduling the task when it's removed or changed by a reload, or the scheduler is stopped
+	stop chan struct{}
+	// The user and group to start the task's processes as. Nil runs them as the scheduler's user
+	credential *processCredential
+	// The IONice setting in the form the system takes it, only used when IONice is set
+	ioPriority int
+	// The request an HTTP task sends, only used when HTTP is set
+	httpMethod string
+	httpURL    string
+	// The built-in task run instead of a program, only set when the command names one
+	builtin *builtinTask
+	// Closed once the task is waiting for its first run, or has stopped being scheduled without one
+	armed     chan struct{}
+	armedOnce sync.Once
+}
+
+// A snapshot of a task in a scheduler and how its runs have gone
+type TaskStatus struct {
+	// The name the task is known by in the HTTP API. Its name, or its command when it doesn't have one, with a number
+	// added to the end if another task already uses it
+	ID   string
+	Task Task
+	// The interval, cron expression or run once time the task is scheduled with
+	Schedule string
+	// When the task's last run started and how it went. Both are empty until the task has run
+	LastRun    time.Time
+	LastStatus string
+	Paused     bool
+	// How many runs have started since the scheduler started, and how many of them have finished succeeding or failing
+	Runs      int64
+	Successes int64
+	Failures  int64
+}
+
+// Creates a scheduler with no tasks. Errors if the options aren't valid or the state file can't be read
+func New(options Options) (*Scheduler, error) {
+	if options.MaxConcurrent < 0 {
+		return nil, fmt.Errorf("the most tasks that can run at once can't be negative")
+	}
+	if options.TaskLogMaxSize < 0 || options.TaskLogMaxBackups < 0 {
+		return nil, fmt.Errorf("the task log max size and max backups can't be negative")
+	}
+	if options.CatchUp && options.StateFile == "" {
+		return nil, fmt.Errorf("catching up on missed runs needs a state file to know which runs were missed")
+	}
+
+	if options.Location == nil {
+		options.Location = time.Local
+	}
+
+	s := &Scheduler{
+		options: options,
+		stopped: make(chan struct{}),
+		metrics: newTaskMetrics(),
+	}
+	s.runContext, s.cancelRuns = context.WithCancel(context.Background())
+	if options.MaxConcurrent > 0 {
+		s.runSlots = &runQueue{limit: options.MaxConcurrent}
+	}
+	if options.Serial {
+		s.serialRuns = &runQueue{limit: 1}
+	}
+	seed := options.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	s.random = rand.New(rand.NewSource(seed))
+	if options.StateFile != "" {
+		stateFile, err := loadTaskStateFile(options.StateFile)
+		if err != nil {
+			return nil, err
+		}
+		s.stateFile = stateFile
+	}
+	return s, nil
+}
+
+// Adds a task to the scheduler. If the scheduler has already started the task is scheduled straight away.
+// Errors if the task's settings aren't valid or its name is already used by another task
+func (s *Scheduler) AddTask(task Task) error {
+	newTask, err := newScheduledTask(task)
+	if err != nil {
+		return err
+	}
+
+	s.tasksMutex.Lock()
+	defer s.tasksMutex.Unlock()
+	if s.isStopped() {
+		return fmt.Errorf("can't add %s as the scheduler has been stopped", newTask.displayName())
+	}
+	if err := assignTaskID(newTask, s.tasks); err != nil {
+		return err
+	}
+	if s.options.TaskLogDir != "" {
+		if err := checkTaskLogFileNames(append(append([]*scheduledTask{}, s.tasks...), newTask)); err != nil {
+			return err
+		}
+	}
+
+	if s.started {
+		// Before starting, a prerequisite could still be added after the task that needs it
+		if err := checkDependencies(append(append([]*scheduledTask{}, s.tasks...), newTask)); err != nil {
+			return err
+		}
+		if s.options.TaskLogDir != "" {
+			if err := s.openTaskLogFile(newTask); err != nil {
+				return err
+			}
+		}
+		s.startScheduling(newTask)
+	}
+	s.tasks = append(s.tasks, newTask)
+	return nil
+}
+
+// Checks a task's settings and gets it ready to be scheduled. Its id is given separately, once it's known which tasks
+// it's scheduled alongside
+func newScheduledTask(task Task) (*scheduledTask, error) {
+	if strings.TrimSpace(task.Command) == "" {
+		return nil, fmt.Errorf("a task needs a command to run")
+	}
+
+	scheduleCount := 0
+	for _, hasSchedule := range []bool{task.Interval != 0, task.Cron != "", !task.At.IsZero()} {
+		if hasSchedule {
+			scheduleCount++
+		}
+	}
+	switch {
+	case scheduleCount == 0:
+		return nil, fmt.Errorf("%s needs an interval, a cron expression or an at time to be scheduled with", task.displayName())
+	case scheduleCount > 1:
+		return nil, fmt.Errorf("%s can only have one of an interval, a cron expression or an at time", task.displayName())
+	case task.Interval < 0 || task.Timeout < 0 || task.RetryDelay < 0 || task.RetryJitter < 0 || task.Jitter < 0 || task.Offset < 0:
+		return nil, fmt.Errorf("the interval, timeout, retry delay, retry jitter, jitter and offset of %s can't be negative", task.displayName())
+	case task.Offset > 0 && task.Interval == 0:
+		return nil, fmt.Errorf("%s can only have an offset when it runs on an interval", task.displayName())
+	case task.Retries < 0:
+		return nil, fmt.Errorf("the retries of %s can't be negative", task.displayName())
+	case task.MaxRuns < 0 || task.MaxFailures < 0:
+		return nil, fmt.Errorf("the max runs and max failures of %s can't be negative", task.displayName())
+	case task.BackoffAfter < 0 || task.BackoffMax < 0:
+		return nil, fmt.Errorf("the backoff settings of %s can't be negative", task.displayName())
+	}
+	for _, code := range task.RetryOnCodes {
+		if code < 0 {
+			return nil, fmt.Errorf("the exit codes to retry %s on can't be negative", task.displayName())
+		}
+	}
+
+	if task.Verbosity == "" {
+		task.Verbosity = VerbosityNormal
+	} else if err := ValidateVerbosity(task.Verbosity); err != nil {
+		return nil, err
+	}
+	if task.Overlap == "" {
+		task.Overlap = OverlapWait
+	} else if err := ValidateOverlapMode(task.Overlap); err != nil {
+		return nil, err
+	}
+	if task.OutputFileMode == "" {
+		task.OutputFileMode = OutputFileTruncate
+	} else if err := ValidateOutputFileMode(task.OutputFileMode); err != nil {
+		return nil, err
+	}
+	if task.PingURL != "" {
+		if err := validatePingURL(task.PingURL); err != nil {
+			return nil, fmt.Errorf("the ping URL of %s %v", task.displayName(), err)
+		}
+	}
+	if task.EnvFile != "" {
+		// Read once up front so a missing or broken file stops the scheduler starting rather than failing every run
+		if _, err := readEnvFile(task.EnvFile); err != nil {
+			return nil, fmt.Errorf("can't load the env of %s: %v", task.displayName(), err)
+		}
+	}
+	// Copy the env vars so changes to the caller's slice don't reach the running task
+	task.Env = append([]string(nil), task.Env...)
+	task.RetryOnCodes = append([]int(nil), task.RetryOnCodes...)
+	labels := task.Labels
+	task.Labels = nil
+	for name, value := range labels {
+		if err := ValidateLabelName(name); err != nil {
+			return nil, fmt.Errorf("%s has an invalid label: %v", task.displayName(), err)
+		}
+		if task.Labels == nil {
+			task.Labels = map[string]string{}
+		}
+		task.Labels[name] = value
+	}
+
+	var credential *processCredential
+	if task.User != "" || task.Group != "" {
+		var err error
+		if credential, err = resolveRunAs(task.User, task.Group); err != nil {
+			return nil, fmt.Errorf("can't run %s as another user. %v", task.displayName(), err)
+		}
+	}
+	if task.Nice < -20 || task.Nice > 19 {
+		return nil, fmt.Errorf("the nice value of %s needs to be between -20 and 19", task.displayName())
+	}
+	if task.Nice != 0 && !niceSupported {
+		return nil, fmt.Errorf("can't set the nice value of %s, it's only supported on Unix", task.displayName())
+	}
+	var ioPriority int
+	if task.IONice != "" {
+		var err error
+		if ioPriority, err = parseIOPriority(task.IONice); err != nil {
+			return nil, fmt.Errorf("invalid IO priority \"%s\" for %s: %v", task.IONice, task.displayName(), err)
+		}
+	}
+
+	var httpMethod, httpURL string
+	if task.HTTP {
+		var err error
+		if httpMethod, httpURL, err = parseHTTPTaskCommand(task.Command); err != nil {
+			return nil, fmt.Errorf("invalid HTTP task %s: %v", task.displayName(), err)
+		}
+	} else if task.HTTPBasicAuth != "" {
+		return nil, fmt.Errorf("%s has basic auth credentials but doesn't make an HTTP request", task.displayName())
+	}
+	var builtin *builtinTask
+	if !task.HTTP && isBuiltinCommand(task.Command) {
+		found, err := lookupBuiltinTask(task.Command)
+		if err != nil {
+			return nil, fmt.Errorf("invalid built-in task %s: %v", task.displayName(), err)
+		}
+		builtin = &found
+	}
+
+	newTask := &scheduledTask{
+		Task:       task,
+		scriptType: scriptTypeOf(task.Command),
+		mutex:      &sync.Mutex{},
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+		// Only the latest result matters, so a single slot is enough
+		runFinished: make(chan struct{}, 1),
+		armed:       make(chan struct{}),
+		credential:  credential,
+		ioPriority:  ioPriority,
+		httpMethod:  httpMethod,
+		httpURL:     httpURL,
+		builtin:     builtin,
+	}
+	if task.HTTP {
+		// A URL ending in .sh is still just a URL
+		newTask.scriptType = ""
+	}
+	if task.Cron != "" {
+		cron, err := parseCronSpec(task.Cron)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cron \"%s\" for %s: %v. %s", task.Cron, task.displayName(), err, cronFieldsHelp)
+		}
+		newTask.cron = cron
+	}
+	return newTask, nil
+}
+
+// Starts scheduling every task in the background and returns straight away. Tasks added after starting are scheduled
+// as soon as they're added. The scheduler is stopped when ctx is done, the same as calling Stop
+func (s *Scheduler) Start(ctx context.Context) error {
+	s.tasksMutex.Lock()
+	defer s.tasksMutex.Unlock()
+	if err := s.prepareToRun(ctx); err != nil {
+		return err
+	}
+
+	s.initialTasks = append([]*scheduledTask{}, s.tasks...)
+	for _, task := range s.tasks {
+		s.startScheduling(task)
+	}
+	return nil
+}
+
+// Checks the tasks can be run and opens their log files, then marks the scheduler as started and stops it once ctx
+// is done. The task list lock must already be held
+func (s *Scheduler) prepareToRun(ctx context.Context) error {
+	if s.started {
+		return fmt.Errorf("the scheduler has already been started")
+	}
+	if s.isStopped() {
+		return fmt.Errorf("the scheduler has been stopped")
+	}
+	if err := checkDependencies(s.tasks); err != nil {
+		return err
+	}
+
+	if s.options.TaskLogDir != "" {
+		if err := os.MkdirAll(s.options.TaskLogDir, 0o755); err != nil {
+			return fmt.Errorf("failed to create the task log directory %s: %v", s.options.TaskLogDir, err)
+		}
+		for _, task := range s.tasks {
+			if err := s.openTaskLogFile(task); err != nil {
+				return err
+			}
+		}
+	}
+
+	s.started = true
+	go func() {
+		select {
+		case <-ctx.Done():
+			LogInfo("Stopping the scheduler once the tasks that are running finish")
+			s.Stop()
+		case <-s.stopped:
+		}
+	}()
+	return nil
+}
+
+// Stops scheduling every task and waits for any runs that are still going to finish. Runs still going after the
+// shutdown grace period are interrupted. A stopped scheduler can't be started again
+func (s *Scheduler) Stop() {
+	firstStop := false
+	s.stopOnce.Do(func() {
+		firstStop = true
+		s.tasksMutex.Lock()
+		defer s.tasksMutex.Unlock()
+		close(s.stopped)
+		for _, task := range s.tasks {
+			close(task.stop)
+		}
+	})
+	if firstStop && s.options.ShutdownGracePeriod > 0 {
+		s.interruptRunsAfterGracePeriod()
+	}
+	s.active.Wait()
+	s.cancelRuns()
+
+	s.tasksMutex.Lock()
+	defer s.tasksMutex.Unlock()
+	closeTaskLogFiles(s.tasks)
+}
+
+// Waits for the runs still going to finish, interrupting any that are still going once the shutdown grace period is up
+func (s *Scheduler) interruptRunsAfterGracePeriod() {
+	finished := make(chan struct{})
+	go func() {
+		s.active.Wait()
+		close(finished)
+	}()
+
+	timer := time.NewTimer(s.options.ShutdownGracePeriod)
+	defer timer.Stop()
+	select {
+	case <-finished:
+		return
+	case <-timer.C:
+	}
+
+	var interrupted []string
+	for _, status := range s.Tasks() {
+		if status.LastStatus == StatusRunning {
+			interrupted = append(interrupted, status.ID)
+		}
+	}
+	if len(interrupted) > 0 {
+		LogWarning(fmt.Sprintf("Tasks were still running %v after stopping. Interrupting %s", s.options.ShutdownGracePeriod, strings.Join(interrupted, ", ")))
+	}
+	s.cancelRuns()
+}
+
+// Blocks until every task has stopped being scheduled and every run has finished. Repeating tasks are scheduled until
+// the scheduler is stopped, so this only returns on its own when every task runs once
+func (s *Scheduler) Wait() {
+	s.active.Wait()
+}
+
+// Whether Stop has been called
+func (s *Scheduler) isStopped() bool {
+	select {
+	case <-s.stopped:
+		return true
+	default:
+		return false
+	}
+}
+
+// Returns the tasks currently being scheduled
+func (s *Scheduler) currentTasks() []*scheduledTask {
+	s.tasksMutex.Lock()
+	defer s.tasksMutex.Unlock()
+	return append([]*scheduledTask{}, s.tasks...)
+}
+
+// Returns every task in the order they were added along with how their runs have gone
+func (s *Scheduler) Tasks() []TaskStatus {
+	var statuses []TaskStatus
+	for _, task := range s.currentTasks() {
+		statuses = append(statuses, task.status())
+	}
+	return statuses
+}
+
+func (t *scheduledTask) status() TaskStatus {
+	status := TaskStatus{
+		ID:       t.id,
+		Task:     t.Task,
+		Schedule: t.describeSchedule(),
+	}
+	status.Task.Env = append([]string(nil), t.Env...)
+	status.Task.RetryOnCodes = append([]int(nil), t.RetryOnCodes...)
+	if t.Labels != nil {
+		status.Task.Labels = map[string]string{}
+		for name, value := range t.Labels {
+			status.Task.Labels[name] = value
+		}
+	}
+	status.Runs = t.runCount.Load()
+	status.Successes = t.successCount.Load()
+	status.Failures = t.failureCount.Load()
+
+	t.stateMutex.Lock()
+	defer t.stateMutex.Unlock()
+	status.LastRun = t.lastRun
+	status.LastStatus = t.lastStatus
+	status.Paused = t.paused
+	return status
+}
+
+// Describes when a task runs the same way it was given
+func (t *scheduledTask) describeSchedule() string {
+	switch {
+	case t.cron != nil:
+		return t.Cron
+	case !t.At.IsZero():
+		return t.At.Format(time.RFC3339)
+	default:
+		return FormatDuration(t.Interval)
+	}
+}
+
+// Works out when a task would first run if the scheduler was started at the given time, not counting any jitter.
+// Returns false if the task would never run, such as a run once task whose time has already passed
+func (s *Scheduler) FirstRun(id string, now time.Time) (time.Time, bool) {
+	task := s.findTask(id)
+	if task == nil || task.Disabled {
+		return time.Time{}, false
+	}
+
+	_, missed := s.missedRunWhileStopped(task, now)
+	switch {
+	case !task.At.IsZero():
+		// Run once tasks don't use run at start
+		if missed {
+			return now, true
+		}
+		return task.At, !task.At.Before(now)
+	case task.RunAtStart || missed:
+		return now.Add(task.Offset), true
+	case task.cron != nil:
+		nextRun := task.cron.next(now.In(s.options.Location))
+		return nextRun, !nextRun.IsZero()
+	default:
+		return now.Add(task.Offset + task.Interval), true
+	}
+}
+
+// Does the parts of running a task that can fail before it starts, so typos are caught before the first run.
+// Checks the interpreter for a script can be found and the script can be read, or that a command's program is on the
+// PATH. Programs and scripts are looked for in the task's working directory when they're a relative path. Built-in
+// tasks are checked to be ones that exist and can run with the scheduler's options
+func (s *Scheduler) CheckRunnable(task Task) error {
+	if !task.HTTP && isBuiltinCommand(task.Command) {
+		builtin, err := lookupBuiltinTask(task.Command)
+		if err != nil || builtin.check == nil {
+			return err
+		}
+		return builtin.check(s)
+	}
+	if s.options.Runner != nil {
+		// The runner decides what the command means
+		return nil
+	}
+	if task.HTTP {
+		// Nothing to find, and whether the URL answers can change by the time it runs
+		return nil
+	}
+	if scriptType := scriptTypeOf(task.Command); scriptType != "" {
+		if _, err := scriptInterpreter(task.Command, scriptType, s.options.Shell); err != nil {
+			return err
+		}
+		script, err := os.Open(pathInWorkingDir(task.Command, task.WorkingDir))
+		if err != nil {
+			return fmt.Errorf("the script can't be read. %v", err)
+		}
+		script.Close()
+		return nil
+	}
+
+	if s.options.UseShell {
+		// The shell works out what the command means
+		if strings.TrimSpace(task.Command) == "" {
+			return fmt.Errorf("its command is empty")
+		}
+		_, err := commandShell(s.options.Shell)
+		return err
+	}
+	program, _ := parseCommandLine(task.Command)
+	if program == "" {
+		return fmt.Errorf("its command is empty")
+	}
+	if strings.ContainsRune(program, '/') || strings.ContainsRune(program, filepath.Separator) {
+		// Paths aren't looked up on the PATH, so check the file itself
+		program = pathInWorkingDir(program, task.WorkingDir)
+	}
+	if _, err := exec.LookPath(program); err != nil {
+		return fmt.Errorf("its program can't be found. %v", err)
+	}
+	return nil
+}
+
+// Resolves a relative path the way it will be when the task runs in its working directory
+func pathInWorkingDir(path string, workingDir string) string {
+	if workingDir == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(workingDir, path)
+}
+
+// Records that the task is waiting for its next run. Only the first call does anything
+func (t *scheduledTask) markArmed() {
+	t.armedOnce.Do(func() { close(t.armed) })
+}
+
+// Records that a run of the task has started
+func (t *scheduledTask) recordRunStarted() {
+	t.stateMutex.Lock()
+	defer t.stateMutex.Unlock()
+	t.lastRun = time.Now()
+	t.lastStatus = StatusRunning
+}
+
+// Records whether the task's latest run succeeded, after any retries
+func (t *scheduledTask) recordRunFinished(succeeded bool) int {
+	t.stateMutex.Lock()
+	defer t.stateMutex.Unlock()
+	if succeeded {
+		t.lastStatus = StatusSuccess
+		t.consecutiveFailures = 0
+		t.successCount.Add(1)
+	} else {
+		t.lastStatus = StatusFailure
+		t.consecutiveFailures++
+		t.failureCount.Add(1)
+	}
+
+	select {
+	case t.runFinished <- struct{}{}:
+	default:
+		// The scheduling loop hasn't caught up with the last run yet, it'll see this result too
+	}
+	return t.consecutiveFailures
+}
+
+// Checks whether a failed run should be retried based on its exit code. Tasks without exit codes to retry on retry
+// every failure
+func (t *scheduledTask) retriesFailure(err error) bool {
+	if len(t.RetryOnCodes) == 0 {
+		return true
+	}
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return false
+	}
+	for _, code := range t.RetryOnCodes {
+		if code == exitErr.ExitCode() {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *scheduledTask) failuresInARow() int {
+	t.stateMutex.Lock()
+	defer t.stateMutex.Unlock()
+	return t.consecutiveFailures
+}
+
+// Adds a finished run's duration to the moving average of the task's run time and returns the new average.
+// Recent runs count for more so the average follows changes in how long the task takes
+func (t *scheduledTask) recordRunTime(elapsed time.Duration) time.Duration {
+	t.stateMutex.Lock()
+	defer t.stateMutex.Unlock()
+	if t.averageRunTime == 0 {
+		t.averageRunTime = elapsed
+	} else {
+		t.averageRunTime = (4*t.averageRunTime + elapsed) / 5
+	}
+	return t.averageRunTime
+}
+
+// The interval to wait between runs given how many runs in a row have failed. Once BackoffAfter runs have failed the
+// interval doubles with every failure, up to BackoffMax
+func (t *scheduledTask) backoffInterval() time.Duration {
+	failures := t.failuresInARow()
+	if t.BackoffAfter == 0 || failures < t.BackoffAfter {
+		return t.Interval
+	}
+	maxInterval := t.BackoffMax
+	if maxInterval == 0 {
+		maxInterval = 16 * t.Interval
+	}
+
+	interval := t.Interval
+	for i := 0; i <= failures-t.BackoffAfter && interval < maxInterval; i++ {
+		interval *= 2
+	}
+	if interval > maxInterval {
+		interval = maxInterval
+	}
+	return interval
+}
+
+// Counts a run of the task as it starts. Returns false without counting it if the task has already run MaxRuns times
+func (t *scheduledTask) startCountedRun() bool {
+	if t.MaxRuns == 0 {
+		t.runCount.Add(1)
+		return true
+	}
+
+	for {
+		count := t.runCount.Load()
+		if count >= int64(t.MaxRuns) {
+			return false
+		}
+		if t.runCount.CompareAndSwap(count, count+1) {
+			if count+1 == int64(t.MaxRuns) {
+				logTaskMessage(levelInfo, t.displayName(), fmt.Sprintf("%s is on its last run of %d, the most set by its max runs. It won't be scheduled again", t.displayName(), t.MaxRuns))
+				t.stopScheduling()
+			}
+			return true
+		}
+	}
+}
+
+// Stops scheduling the task for good. Safe to call more than once, e.g. when it fails too often on its last run
+func (t *scheduledTask) stopScheduling() {
+	t.doneOnce.Do(func() { close(t.done) })
+}
+
+func (t *scheduledTask) setPaused(paused bool) {
+	t.stateMutex.Lock()
+	defer t.stateMutex.Unlock()
+	t.paused = paused
+}
+
+func (t *scheduledTask) isPaused() bool {
+	t.stateMutex.Lock()
+	defer t.stateMutex.Unlock()
+	return t.paused
+}
@@ -0,0 +1,92 @@
+package scheduler
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// Works out whether a task is a local script file rather than a command, based on its extension.
+// Returns the lowercase extension for supported scripts, or an empty string for commands
+func scriptTypeOf(taskCommand string) string {
+	extension := strings.ToLower(filepath.Ext(taskCommand))
+	switch extension {
+	case ".sh", ".bat", ".cmd", ".ps1", ".py":
+		return extension
+	}
+	return ""
+}
+
+// Finds the interpreter to run a script with, returned as the program followed by any arguments that need to come
+// before the script's path. Shell is the shell to run .sh scripts with, empty to find one
+func scriptInterpreter(scriptPath string, scriptType string, shell string) ([]string, error) {
+	switch scriptType {
+	case ".sh":
+		shellPath, err := findShell(shell)
+		if err != nil {
+			return nil, err
+		}
+		return []string{shellPath}, nil
+	case ".bat", ".cmd":
+		if runtime.GOOS != "windows" {
+			return nil, fmt.Errorf("%s is a Windows batch file and can only be run on Windows", scriptPath)
+		}
+		return []string{"cmd", "/c"}, nil
+	case ".ps1":
+		// Prefer the cross platform PowerShell, Windows always has the older built in one to fall back to
+		if pwshPath, err := exec.LookPath("pwsh"); err == nil {
+			return []string{pwshPath, "-File"}, nil
+		}
+		if runtime.GOOS == "windows" {
+			return []string{"powershell.exe", "-File"}, nil
+		}
+		return nil, fmt.Errorf("PowerShell (pwsh) wasn't found on the PATH, it's needed to run %s", scriptPath)
+	case ".py":
+		// Windows installs usually only have python rather than python3
+		for _, python := range []string{"python3", "python"} {
+			if pythonPath, err := exec.LookPath(python); err == nil {
+				return []string{pythonPath}, nil
+			}
+		}
+		return nil, fmt.Errorf("python3 wasn't found on the PATH, it's needed to run %s", scriptPath)
+	}
+	return nil, fmt.Errorf("%s isn't a supported script type", scriptPath)
+}
+
+// Finds the shell to run commands through when UseShell is set, returned as the program followed by the arguments that
+// come before the command. The shell the scheduler was given is used with -c, otherwise sh (or cmd on Windows). $SHELL
+// isn't used as commands shouldn't change meaning depending on who starts the scheduler
+func commandShell(shell string) ([]string, error) {
+	if shell != "" {
+		return []string{shell, "-c"}, nil
+	}
+	if runtime.GOOS == "windows" {
+		return []string{"cmd", "/C"}, nil
+	}
+	shPath, err := exec.LookPath("sh")
+	if err != nil {
+		return nil, fmt.Errorf("sh wasn't found on the PATH, it's needed to run commands through a shell. Pass the path to one with --shell")
+	}
+	return []string{shPath, "-c"}, nil
+}
+
+// Finds the shell for .sh scripts. The shell the scheduler was given takes priority, followed by the user's $SHELL
+// and then bash from the PATH
+func findShell(shell string) (string, error) {
+	if shell != "" {
+		return shell, nil
+	}
+	if shell := os.Getenv("SHELL"); shell != "" {
+		return shell, nil
+	}
+	if bashPath, err := exec.LookPath("bash"); err == nil {
+		return bashPath, nil
+	}
+	if shPath, err := exec.LookPath("sh"); err == nil {
+		return shPath, nil
+	}
+	return "", fmt.Errorf("no shell was found to run .sh scripts with. Install bash or pass the path to one with --shell")
+}
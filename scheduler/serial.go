@@ -0,0 +1,127 @@
+package scheduler
+
+import (
+	"fmt"
+	"sync"
+)
+
+// A queue runs wait in for a turn when only so many can run at once, either one at a time when the scheduler runs
+// tasks serially or up to MaxConcurrent. Waiting runs are given their turn highest priority first, and in the order
+// they started waiting when their priorities are the same
+type runQueue struct {
+	mutex sync.Mutex
+	// How many runs can have a turn at once, and how many have one
+	limit   int
+	running int
+	waiting []queuedRun
+}
+
+// A run waiting in a runQueue
+type queuedRun struct {
+	priority int
+	// Closed to give the run its turn
+	turn chan struct{}
+}
+
+// Waits for a turn, behind every run with a higher priority and the runs with the same priority that were queued
+// first. Returns false without a turn if the scheduler stops first
+func (q *runQueue) waitForTurn(priority int, stopped <-chan struct{}) bool {
+	select {
+	case <-stopped:
+		// Waited behind an earlier run of the same task until after the scheduler stopped
+		return false
+	default:
+	}
+
+	q.mutex.Lock()
+	if q.running < q.limit {
+		q.running++
+		q.mutex.Unlock()
+		return true
+	}
+	turn := make(chan struct{})
+	q.waiting = append(q.waiting, queuedRun{priority: priority, turn: turn})
+	q.mutex.Unlock()
+
+	select {
+	case <-turn:
+		return true
+	case <-stopped:
+	}
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	for i, waiting := range q.waiting {
+		if waiting.turn == turn {
+			q.waiting = append(q.waiting[:i], q.waiting[i+1:]...)
+			return false
+		}
+	}
+	// Given its turn at the same time as the scheduler stopped, so pass it on to the next run
+	q.nextTurn()
+	return false
+}
+
+// Takes a turn if one is free straight away, without waiting. Returns false if every turn is taken
+func (q *runQueue) tryTurn() bool {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if q.running < q.limit {
+		q.running++
+		return true
+	}
+	return false
+}
+
+// Ends a run's turn, giving it to the next queued run if there is one
+func (q *runQueue) finishTurn() {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.nextTurn()
+}
+
+// Gives the turn that's just finished to the queued run with the highest priority, the earliest queued of them when
+// several share it. The lock must already be held
+func (q *runQueue) nextTurn() {
+	if len(q.waiting) == 0 {
+		q.running--
+		return
+	}
+	next := 0
+	for i, waiting := range q.waiting {
+		if waiting.priority > q.waiting[next].priority {
+			next = i
+		}
+	}
+	close(q.waiting[next].turn)
+	q.waiting = append(q.waiting[:next], q.waiting[next+1:]...)
+}
+
+// Whether every turn is taken, meaning the next run will have to wait
+func (q *runQueue) busy() bool {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return q.running >= q.limit
+}
+
+// Waits for the task's turn when Serial is set. Returns false if the scheduler stopped while it was waiting
+func (s *Scheduler) waitForSerialTurn(task *scheduledTask) bool {
+	if s.serialRuns == nil {
+		return true
+	}
+	if s.serialRuns.busy() {
+		logTaskMessage(levelInfo, task.displayName(), fmt.Sprintf("%s is queued behind the task that's running as --serial only runs one task at a time", task.displayName()))
+	}
+	if !s.serialRuns.waitForTurn(task.Priority, s.stopped) {
+		logTaskMessage(levelInfo, task.displayName(), fmt.Sprintf("%s was still queued when the scheduler stopped. Skipping this run", task.displayName()))
+		return false
+	}
+	return true
+}
+
+// Ends the turn taken by waitForSerialTurn
+func (s *Scheduler) finishSerialTurn() {
+	if s.serialRuns != nil {
+		s.serialRuns.finishTurn()
+	}
+}
@@ -0,0 +1,115 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// The last successful run of every task, keyed by task id. Saved to disk after every successful run.
+// Safe to update from many task goroutines at once
+type taskStateFile struct {
+	mutex       sync.Mutex
+	path        string
+	lastSuccess map[string]time.Time
+}
+
+// Loads the state file at the given path. A file that doesn't exist yet is treated as empty, it's created after the
+// first successful run
+func loadTaskStateFile(statePath string) (*taskStateFile, error) {
+	state := &taskStateFile{path: statePath, lastSuccess: map[string]time.Time{}}
+
+	data, err := os.ReadFile(statePath)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the state file at %s: %v", statePath, err)
+	}
+	if err := json.Unmarshal(data, &state.lastSuccess); err != nil {
+		return nil, fmt.Errorf("the state file %s isn't valid: %v", statePath, err)
+	}
+	return state, nil
+}
+
+// Returns when a task last succeeded and whether it has succeeded before
+func (s *taskStateFile) lastSuccessOf(taskID string) (time.Time, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	lastSuccess, exists := s.lastSuccess[taskID]
+	return lastSuccess, exists
+}
+
+// Records a successful run of a task and saves the state file
+func (s *taskStateFile) recordSuccess(taskID string, runAt time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.lastSuccess[taskID] = runAt
+	if err := s.save(); err != nil {
+		LogError(fmt.Sprintf("Failed to save the state file %s. %v", s.path, err))
+	}
+}
+
+// Saves the state file with the times already recorded
+func (s *taskStateFile) saveNow() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.save()
+}
+
+// Writes the state to a temporary file and moves it over the old one, so a crash mid write can't leave a broken
+// state file behind. The lock must already be held
+func (s *taskStateFile) save() error {
+	data, err := json.MarshalIndent(s.lastSuccess, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tempFile, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	// Only does anything if the rename didn't happen
+	defer os.Remove(tempFile.Name())
+
+	if _, err := tempFile.Write(data); err != nil {
+		tempFile.Close()
+		return err
+	}
+	if err := tempFile.Sync(); err != nil {
+		tempFile.Close()
+		return err
+	}
+	if err := tempFile.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tempFile.Name(), s.path)
+}
+
+// Checks whether a task missed a run while the scheduler was stopped, returning when that run was due.
+// Always false unless CatchUp is set. Repeating tasks that have never succeeded have nothing to catch up on
+func (s *Scheduler) missedRunWhileStopped(task *scheduledTask, now time.Time) (time.Time, bool) {
+	if !s.options.CatchUp || s.stateFile == nil {
+		return time.Time{}, false
+	}
+
+	lastSuccess, hasRun := s.stateFile.lastSuccessOf(task.id)
+	switch {
+	case !task.At.IsZero():
+		// Run once tasks are missed if their time passed without them succeeding
+		missed := task.At.Before(now) && (!hasRun || lastSuccess.Before(task.At))
+		return task.At, missed
+	case !hasRun:
+		return time.Time{}, false
+	case task.cron != nil:
+		dueAt := task.cron.next(lastSuccess.In(s.options.Location))
+		return dueAt, !dueAt.IsZero() && dueAt.Before(now)
+	default:
+		dueAt := lastSuccess.Add(task.Interval)
+		return dueAt, dueAt.Before(now)
+	}
+}
@@ -0,0 +1,70 @@
+package scheduler
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// Logs a task's output a line at a time as it's written, instead of all at once when the run finishes. Used as a
+// command's stdout or stderr when StreamOutput is set
+type outputStreamer struct {
+	task *scheduledTask
+	// Which output the lines came from, shown in every line (e.g. "stdout")
+	source string
+	// The end of the output that hasn't been ended with a newline yet
+	partialLine []byte
+	// The longest a line can get before it's logged anyway, so output without newlines can't grow without limit
+	maxLineBytes int
+}
+
+// Lines are cut at maxOutputBytes, the same limit as buffered output. Zero or less cuts them at the default limit, as
+// streamed lines are logged rather than dropped once they're cut
+func newOutputStreamer(task *scheduledTask, source string, maxOutputBytes int64) *outputStreamer {
+	maxLineBytes := defaultMaxOutputBytes
+	if maxOutputBytes > 0 {
+		maxLineBytes = int(maxOutputBytes)
+	}
+	return &outputStreamer{task: task, source: source, maxLineBytes: maxLineBytes}
+}
+
+// Logs every full line written so far, holding on to anything after the last newline until the rest of it arrives.
+// A line that reaches maxLineBytes without a newline is logged in pieces of that size
+func (o *outputStreamer) Write(output []byte) (int, error) {
+	o.partialLine = append(o.partialLine, output...)
+	for {
+		lineEnd := bytes.IndexByte(o.partialLine, '\n')
+		if lineEnd == -1 {
+			break
+		}
+		o.logLine(string(bytes.TrimRight(o.partialLine[:lineEnd], "\r")))
+		o.partialLine = o.partialLine[lineEnd+1:]
+	}
+	for len(o.partialLine) >= o.maxLineBytes {
+		o.logLine(string(o.partialLine[:o.maxLineBytes]))
+		o.partialLine = o.partialLine[o.maxLineBytes:]
+	}
+	if len(o.partialLine) == 0 {
+		// Let go of the array the logged lines were held in
+		o.partialLine = nil
+	}
+	return len(output), nil
+}
+
+// Logs whatever is left once the task has finished, in case its output didn't end with a newline
+func (o *outputStreamer) Flush() {
+	if len(o.partialLine) > 0 {
+		o.logLine(string(o.partialLine))
+		o.partialLine = nil
+	}
+}
+
+func (o *outputStreamer) logLine(line string) {
+	taskName := o.task.displayName()
+	entry := logEntry{Level: levelInfo, Task: taskName, Message: line}
+	if o.source == "stderr" {
+		entry.Stderr = line
+	} else {
+		entry.Stdout = line
+	}
+	writeTaskLog(o.task, entry, fmt.Sprintf("%s [%s] %s", taskName, o.source, line))
+}
@@ -0,0 +1,35 @@
+package scheduler
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestOutputStreamerCutsLongLines(t *testing.T) {
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	streamer := newOutputStreamer(&scheduledTask{Task: Task{Command: "noisy"}}, "stdout", 10)
+	// Written in small pieces without a newline, like a progress bar
+	for i := 0; i < 100; i++ {
+		streamer.Write([]byte("abc"))
+	}
+	if len(streamer.partialLine) >= 10 {
+		t.Errorf("held on to %d bytes without a newline, expected less than the 10 byte limit", len(streamer.partialLine))
+	}
+	streamer.Write([]byte("end\n"))
+	streamer.Flush()
+
+	// 300 bytes cut into 10 byte lines, then the rest joined up with the line's real end
+	lines := strings.Split(strings.TrimSpace(logs.String()), "\n")
+	if len(lines) != 31 {
+		t.Fatalf("expected 31 lines, got %d:\n%s", len(lines), logs.String())
+	}
+	if !strings.HasSuffix(lines[0], "noisy [stdout] abcabcabca") || !strings.HasSuffix(lines[30], "noisy [stdout] end") {
+		t.Errorf("lines weren't cut at the limit:\n%s", logs.String())
+	}
+}
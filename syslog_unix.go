@@ -0,0 +1,91 @@
+//go:build !windows
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"log/syslog"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The syslog facilities --syslog-facility can be set to, by name
+var syslogFacilities = map[string]syslog.Priority{
+	"kern":     syslog.LOG_KERN,
+	"user":     syslog.LOG_USER,
+	"mail":     syslog.LOG_MAIL,
+	"daemon":   syslog.LOG_DAEMON,
+	"auth":     syslog.LOG_AUTH,
+	"syslog":   syslog.LOG_SYSLOG,
+	"lpr":      syslog.LOG_LPR,
+	"news":     syslog.LOG_NEWS,
+	"uucp":     syslog.LOG_UUCP,
+	"cron":     syslog.LOG_CRON,
+	"authpriv": syslog.LOG_AUTHPRIV,
+	"ftp":      syslog.LOG_FTP,
+	"local0":   syslog.LOG_LOCAL0,
+	"local1":   syslog.LOG_LOCAL1,
+	"local2":   syslog.LOG_LOCAL2,
+	"local3":   syslog.LOG_LOCAL3,
+	"local4":   syslog.LOG_LOCAL4,
+	"local5":   syslog.LOG_LOCAL5,
+	"local6":   syslog.LOG_LOCAL6,
+	"local7":   syslog.LOG_LOCAL7,
+}
+
+// Checks --syslog can be used with the given facility
+func checkSyslogOptions(facility string) error {
+	if _, exists := syslogFacilities[facility]; !exists {
+		var names []string
+		for name := range syslogFacilities {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("unknown --syslog-facility \"%s\", expected one of %s", facility, strings.Join(names, ", "))
+	}
+	return nil
+}
+
+// Sets up the system logger to send every line to the local syslog daemon instead of a file, under the given facility
+// and tag. The facility has already been checked by checkSyslogOptions
+func setupSyslog(facility string, tag string) {
+	writer, err := syslog.New(syslogFacilities[facility]|syslog.LOG_INFO, tag)
+	if err != nil {
+		logFatal(fmt.Sprintf("Failed to connect to syslog. %v", err))
+	}
+	log.SetOutput(syslogWriter{writer: writer})
+}
+
+// The layout of the timestamp the system logger starts each line with, which syslog already records
+const logTimestampLayout = "2006/01/02 15:04:05 "
+
+// Sends each log line to syslog at the priority of its level, going by the marker warnings and errors start with in
+// the text format and the level field in the json format
+type syslogWriter struct {
+	writer *syslog.Writer
+}
+
+func (w syslogWriter) Write(data []byte) (int, error) {
+	line := strings.TrimSuffix(string(data), "\n")
+	if len(line) >= len(logTimestampLayout) {
+		if _, err := time.Parse(logTimestampLayout, line[:len(logTimestampLayout)]); err == nil {
+			line = line[len(logTimestampLayout):]
+		}
+	}
+
+	var err error
+	switch {
+	case strings.HasPrefix(line, "ERROR!: ") || strings.Contains(line, `"level":"error"`):
+		err = w.writer.Err(line)
+	case strings.HasPrefix(line, "WARNING!: ") || strings.Contains(line, `"level":"warning"`):
+		err = w.writer.Warning(line)
+	default:
+		err = w.writer.Info(line)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
@@ -0,0 +1,13 @@
+//go:build windows
+
+package main
+
+import "fmt"
+
+// Windows has no syslog, so --syslog can't be used
+func checkSyslogOptions(facility string) error {
+	return fmt.Errorf("--syslog isn't supported on Windows, which has no syslog. Use --logs instead")
+}
+
+// Never called on Windows, as checkSyslogOptions always fails
+func setupSyslog(facility string, tag string) {}
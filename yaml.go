@@ -0,0 +1,426 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// A small YAML parser covering what task config files need: block mappings and sequences, quoted and plain scalars,
+// literal (|) and folded (>) block scalars, simple flow collections ([a, b] and {a: b}) and comments.
+// Anchors, tags and multiple documents aren't supported.
+// Values are decoded into maps, slices, strings, bools, int64s, float64s and nils so they can be re-encoded as JSON
+
+// A single non-empty line of a YAML document with its comment removed
+type yamlLine struct {
+	number int
+	indent int
+	text   string
+	// The line as written, needed for block scalars where spacing and # characters must be kept
+	raw string
+}
+
+type yamlParser struct {
+	lines []yamlLine
+	pos   int
+}
+
+// Parses a YAML document into generic values
+func parseYAML(data string) (interface{}, error) {
+	parser := &yamlParser{}
+
+	for i, rawLine := range strings.Split(strings.ReplaceAll(data, "\r\n", "\n"), "\n") {
+		trimmed := strings.TrimLeft(rawLine, " ")
+		if strings.HasPrefix(trimmed, "\t") {
+			return nil, fmt.Errorf("yaml: line %d: tabs can't be used for indentation", i+1)
+		}
+		text := strings.TrimRight(stripYAMLComment(trimmed), " \t")
+		if text == "---" && len(parser.lines) == 0 {
+			// Document start marker
+			continue
+		}
+		parser.lines = append(parser.lines, yamlLine{
+			number: i + 1,
+			indent: len(rawLine) - len(trimmed),
+			text:   text,
+			raw:    rawLine,
+		})
+	}
+
+	parser.skipBlankLines()
+	if parser.pos >= len(parser.lines) {
+		return nil, nil
+	}
+
+	value, err := parser.parseNode(parser.lines[parser.pos].indent)
+	if err != nil {
+		return nil, err
+	}
+
+	parser.skipBlankLines()
+	if parser.pos < len(parser.lines) {
+		line := parser.lines[parser.pos]
+		return nil, fmt.Errorf("yaml: line %d: unexpected indentation", line.number)
+	}
+	return value, nil
+}
+
+// Removes a trailing comment from a line. A # only starts a comment at the start of a line or after a space,
+// and never inside quotes
+func stripYAMLComment(text string) string {
+	var quote rune
+	for i, char := range text {
+		switch {
+		case quote != 0:
+			if char == quote {
+				quote = 0
+			}
+		case isYAMLQuoteStart(text, i):
+			quote = char
+		case char == '#' && (i == 0 || text[i-1] == ' ' || text[i-1] == '\t'):
+			return text[:i]
+		}
+	}
+	return text
+}
+
+// Quotes only start a quoted value at the beginning of a token, so apostrophes in plain text (e.g. echo it's) are kept
+func isYAMLQuoteStart(text string, i int) bool {
+	if text[i] != '"' && text[i] != '\'' {
+		return false
+	}
+	return i == 0 || strings.ContainsRune(" \t[{,:", rune(text[i-1]))
+}
+
+// Blank and comment only lines are kept for block scalars but are otherwise skipped
+func (p *yamlParser) skipBlankLines() {
+	for p.pos < len(p.lines) && p.lines[p.pos].text == "" {
+		p.pos++
+	}
+}
+
+// Parses the block starting at the current line, which sits at the given indent
+func (p *yamlParser) parseNode(indent int) (interface{}, error) {
+	line := p.lines[p.pos]
+
+	if line.text == "-" || strings.HasPrefix(line.text, "- ") {
+		return p.parseSequence(indent)
+	}
+	if _, _, isKey := splitYAMLKey(line.text); isKey {
+		return p.parseMapping(indent)
+	}
+
+	// A lone scalar value
+	p.pos++
+	return parseYAMLScalar(line.text, line.number)
+}
+
+// Parses a block sequence where every item starts with "- " at the given indent
+func (p *yamlParser) parseSequence(indent int) ([]interface{}, error) {
+	items := []interface{}{}
+
+	for {
+		p.skipBlankLines()
+		if p.pos >= len(p.lines) {
+			return items, nil
+		}
+		line := p.lines[p.pos]
+		if line.indent < indent {
+			return items, nil
+		}
+		if line.indent > indent {
+			return nil, fmt.Errorf("yaml: line %d: unexpected indentation", line.number)
+		}
+		if line.text != "-" && !strings.HasPrefix(line.text, "- ") {
+			return items, nil
+		}
+
+		content := strings.TrimLeft(strings.TrimPrefix(line.text, "-"), " ")
+		if content == "" {
+			// The item's value is the indented block on the following lines
+			p.pos++
+			item, err := p.parseChildNode(indent, false)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+			continue
+		}
+
+		// The item's value starts on the same line as the dash (e.g. "- name: backup"). Treat it as if it was
+		// written on its own line, indented to where the content starts, so following keys line up with it
+		contentIndent := indent + len(line.text) - len(content)
+		p.lines[p.pos] = yamlLine{number: line.number, indent: contentIndent, text: content, raw: line.raw}
+		item, err := p.parseNode(contentIndent)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+}
+
+// Parses a block mapping of "key: value" lines at the given indent
+func (p *yamlParser) parseMapping(indent int) (map[string]interface{}, error) {
+	mapping := map[string]interface{}{}
+
+	for {
+		p.skipBlankLines()
+		if p.pos >= len(p.lines) {
+			return mapping, nil
+		}
+		line := p.lines[p.pos]
+		if line.indent < indent {
+			return mapping, nil
+		}
+		if line.indent > indent {
+			return nil, fmt.Errorf("yaml: line %d: unexpected indentation", line.number)
+		}
+
+		key, valueText, isKey := splitYAMLKey(line.text)
+		if !isKey {
+			if line.text == "-" || strings.HasPrefix(line.text, "- ") {
+				// A sequence item at the mapping's level ends the mapping (it belongs to a parent sequence)
+				return mapping, nil
+			}
+			return nil, fmt.Errorf("yaml: line %d: expected a \"key: value\" pair", line.number)
+		}
+		if _, exists := mapping[key]; exists {
+			return nil, fmt.Errorf("yaml: line %d: the key \"%s\" is defined more than once", line.number, key)
+		}
+		p.pos++
+
+		var value interface{}
+		var err error
+		switch {
+		case valueText == "":
+			// A sequence value can sit at the same indent as its key
+			value, err = p.parseChildNode(indent, true)
+		case strings.HasPrefix(valueText, "|") || strings.HasPrefix(valueText, ">"):
+			value, err = p.parseBlockScalar(indent, valueText, line.number)
+		default:
+			value, err = parseYAMLScalar(valueText, line.number)
+		}
+		if err != nil {
+			return nil, err
+		}
+		mapping[key] = value
+	}
+}
+
+// Parses the indented block under a key or dash. Returns nil when there isn't one (e.g. "key:" with no value)
+func (p *yamlParser) parseChildNode(parentIndent int, allowSameIndentSequence bool) (interface{}, error) {
+	p.skipBlankLines()
+	if p.pos >= len(p.lines) {
+		return nil, nil
+	}
+
+	line := p.lines[p.pos]
+	isSequence := line.text == "-" || strings.HasPrefix(line.text, "- ")
+	if line.indent > parentIndent || (allowSameIndentSequence && isSequence && line.indent == parentIndent) {
+		return p.parseNode(line.indent)
+	}
+	return nil, nil
+}
+
+// Parses a literal (|) or folded (>) block scalar made of all the lines indented further than the key
+func (p *yamlParser) parseBlockScalar(parentIndent int, header string, lineNumber int) (string, error) {
+	style := header[0]
+	chomping := strings.TrimSpace(header[1:])
+	if chomping != "" && chomping != "-" && chomping != "+" {
+		return "", fmt.Errorf("yaml: line %d: unsupported block scalar header \"%s\"", lineNumber, header)
+	}
+
+	var blockLines []string
+	blockIndent := -1
+	for p.pos < len(p.lines) {
+		line := p.lines[p.pos]
+		isBlank := strings.TrimSpace(line.raw) == ""
+		if !isBlank && line.indent <= parentIndent {
+			break
+		}
+		if !isBlank && blockIndent == -1 {
+			blockIndent = line.indent
+		}
+		if isBlank || blockIndent == -1 {
+			blockLines = append(blockLines, "")
+		} else {
+			if line.indent < blockIndent {
+				return "", fmt.Errorf("yaml: line %d: block scalar lines must be indented at least as far as the first line", line.number)
+			}
+			blockLines = append(blockLines, strings.TrimRight(line.raw[blockIndent:], "\r"))
+		}
+		p.pos++
+	}
+
+	// Trailing blank lines are only kept with the keep (+) indicator
+	trailing := 0
+	for len(blockLines) > 0 && blockLines[len(blockLines)-1] == "" {
+		blockLines = blockLines[:len(blockLines)-1]
+		trailing++
+	}
+
+	var value string
+	if style == '|' {
+		value = strings.Join(blockLines, "\n")
+	} else {
+		// Folded scalars join lines with spaces, with blank lines becoming newlines
+		var folded strings.Builder
+		for i, blockLine := range blockLines {
+			switch {
+			case blockLine == "":
+				folded.WriteString("\n")
+			case i > 0 && blockLines[i-1] != "":
+				folded.WriteString(" " + blockLine)
+			default:
+				folded.WriteString(blockLine)
+			}
+		}
+		value = folded.String()
+	}
+
+	switch {
+	case len(blockLines) == 0:
+		return "", nil
+	case chomping == "-":
+		return value, nil
+	case chomping == "+":
+		return value + strings.Repeat("\n", trailing+1), nil
+	default:
+		return value + "\n", nil
+	}
+}
+
+// Splits a "key: value" line. Returns false if the line isn't a mapping entry
+func splitYAMLKey(text string) (string, string, bool) {
+	if strings.HasPrefix(text, "\"") || strings.HasPrefix(text, "'") {
+		// Quoted key
+		closing := strings.IndexByte(text[1:], text[0])
+		if closing == -1 {
+			return "", "", false
+		}
+		rest := text[closing+2:]
+		if rest != ":" && !strings.HasPrefix(rest, ": ") {
+			return "", "", false
+		}
+		return text[1 : closing+1], strings.TrimSpace(rest[1:]), true
+	}
+	if strings.HasPrefix(text, "[") || strings.HasPrefix(text, "{") {
+		return "", "", false
+	}
+
+	for i := 0; i < len(text); i++ {
+		if text[i] == ':' && (i == len(text)-1 || text[i+1] == ' ') {
+			return strings.TrimSpace(text[:i]), strings.TrimSpace(text[i+1:]), true
+		}
+	}
+	return "", "", false
+}
+
+// Parses an inline value, either a quoted string, a flow collection or a plain scalar
+func parseYAMLScalar(text string, lineNumber int) (interface{}, error) {
+	switch {
+	case strings.HasPrefix(text, "\""):
+		// YAML's double quoted escapes are close enough to Go's for config values
+		value, err := strconv.Unquote(text)
+		if err != nil {
+			return nil, fmt.Errorf("yaml: line %d: invalid double quoted string: %v", lineNumber, err)
+		}
+		return value, nil
+	case strings.HasPrefix(text, "'"):
+		if len(text) < 2 || !strings.HasSuffix(text, "'") {
+			return nil, fmt.Errorf("yaml: line %d: unterminated single quoted string", lineNumber)
+		}
+		// Single quotes are escaped by doubling them
+		return strings.ReplaceAll(text[1:len(text)-1], "''", "'"), nil
+	case strings.HasPrefix(text, "["):
+		if !strings.HasSuffix(text, "]") {
+			return nil, fmt.Errorf("yaml: line %d: unterminated flow sequence", lineNumber)
+		}
+		items := []interface{}{}
+		for _, itemText := range splitYAMLFlow(text[1 : len(text)-1]) {
+			item, err := parseYAMLScalar(itemText, lineNumber)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		return items, nil
+	case strings.HasPrefix(text, "{"):
+		if !strings.HasSuffix(text, "}") {
+			return nil, fmt.Errorf("yaml: line %d: unterminated flow mapping", lineNumber)
+		}
+		mapping := map[string]interface{}{}
+		for _, entryText := range splitYAMLFlow(text[1 : len(text)-1]) {
+			key, valueText, isKey := splitYAMLKey(entryText)
+			if !isKey {
+				return nil, fmt.Errorf("yaml: line %d: expected a \"key: value\" pair in flow mapping, found \"%s\"", lineNumber, entryText)
+			}
+			value, err := parseYAMLScalar(valueText, lineNumber)
+			if err != nil {
+				return nil, err
+			}
+			mapping[key] = value
+		}
+		return mapping, nil
+	}
+
+	if _, _, isKey := splitYAMLKey(text); isKey {
+		// e.g. "a: b: c", which YAML rejects rather than reading as the string "b: c"
+		return nil, fmt.Errorf("yaml: line %d: a plain value can't contain \": \", quote it to use one", lineNumber)
+	}
+	return resolvePlainYAMLScalar(text), nil
+}
+
+// Splits the inside of a flow collection on commas that aren't within quotes or nested collections
+func splitYAMLFlow(text string) []string {
+	var parts []string
+	depth := 0
+	var quote rune
+	start := 0
+
+	for i, char := range text {
+		switch {
+		case quote != 0:
+			if char == quote {
+				quote = 0
+			}
+		case isYAMLQuoteStart(text, i):
+			quote = char
+		case char == '[' || char == '{':
+			depth++
+		case char == ']' || char == '}':
+			depth--
+		case char == ',' && depth == 0:
+			parts = append(parts, strings.TrimSpace(text[start:i]))
+			start = i + 1
+		}
+	}
+
+	if last := strings.TrimSpace(text[start:]); last != "" {
+		parts = append(parts, last)
+	}
+	return parts
+}
+
+// Works out the type of an unquoted value the same way YAML's core schema does
+func resolvePlainYAMLScalar(text string) interface{} {
+	switch text {
+	case "", "~", "null", "Null", "NULL":
+		return nil
+	case "true", "True", "TRUE":
+		return true
+	case "false", "False", "FALSE":
+		return false
+	}
+
+	if intValue, err := strconv.ParseInt(text, 10, 64); err == nil {
+		return intValue
+	}
+	// Only plain decimal numbers, so values like "inf" or "1_000" stay as strings
+	if strings.Trim(text, "0123456789.eE+-") == "" {
+		if floatValue, err := strconv.ParseFloat(text, 64); err == nil {
+			return floatValue
+		}
+	}
+	return text
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseYAML(t *testing.T) {
+	tests := []struct {
+		name     string
+		document string
+		expected interface{}
+	}{
+		{
+			name:     "block mapping and sequence",
+			document: "tasks:\n  - name: backup\n    interval: 1h\n  - name: report\n    retries: 3\n",
+			expected: map[string]interface{}{"tasks": []interface{}{
+				map[string]interface{}{"name": "backup", "interval": "1h"},
+				map[string]interface{}{"name": "report", "retries": int64(3)},
+			}},
+		},
+		{
+			name:     "sequence at the same indent as its key",
+			document: "tags:\n- a\n- b\n",
+			expected: map[string]interface{}{"tags": []interface{}{"a", "b"}},
+		},
+		{
+			name:     "flow collections",
+			document: "env: {A: 1, B: 'two, three'}\nlabels: [x, \"y\", [z]]\n",
+			expected: map[string]interface{}{
+				"env":    map[string]interface{}{"A": int64(1), "B": "two, three"},
+				"labels": []interface{}{"x", "y", []interface{}{"z"}},
+			},
+		},
+		{
+			name:     "literal block scalar",
+			document: "command: |\n  echo one\n  echo # not a comment\n\nnext: value\n",
+			expected: map[string]interface{}{"command": "echo one\necho # not a comment\n", "next": "value"},
+		},
+		{
+			name:     "folded block scalar with strip chomping",
+			document: "command: >-\n  echo one\n  two\n\n  three\n",
+			expected: map[string]interface{}{"command": "echo one two\nthree"},
+		},
+		{
+			name:     "comments outside quotes are dropped",
+			document: "# tasks\nname: backup # the nightly one\n",
+			expected: map[string]interface{}{"name": "backup"},
+		},
+		{
+			name:     "a # inside quotes or a word isn't a comment",
+			document: "double: \"a # b\"\nsingle: 'a # b'\nurl: https://example.com/a#b\n",
+			expected: map[string]interface{}{"double": "a # b", "single": "a # b", "url": "https://example.com/a#b"},
+		},
+		{
+			name:     "doubled single quotes",
+			document: "command: 'echo ''hi'' it''s me'\n",
+			expected: map[string]interface{}{"command": "echo 'hi' it's me"},
+		},
+		{
+			name:     "apostrophes inside plain values",
+			document: "command: echo it's fine\n",
+			expected: map[string]interface{}{"command": "echo it's fine"},
+		},
+		{
+			name:     "plain scalar types",
+			document: "a: true\nb: ~\nc: 1.5\nd: 1_000\ne: \"5\"\n",
+			expected: map[string]interface{}{"a": true, "b": nil, "c": 1.5, "d": "1_000", "e": "5"},
+		},
+		{
+			name:     "quoted value containing a colon",
+			document: "a: \"b: c\"\n",
+			expected: map[string]interface{}{"a": "b: c"},
+		},
+		{
+			name:     "empty document",
+			document: "---\n# nothing here\n",
+			expected: nil,
+		},
+	}
+	for _, test := range tests {
+		value, err := parseYAML(test.document)
+		if err != nil {
+			t.Errorf("%s: parseYAML failed: %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(value, test.expected) {
+			t.Errorf("%s: parseYAML = %#v, expected %#v", test.name, value, test.expected)
+		}
+	}
+}
+
+func TestParseYAMLRejectsInvalidDocuments(t *testing.T) {
+	tests := []struct {
+		name     string
+		document string
+		// Part of the error expected
+		errorText string
+	}{
+		{"tab indentation", "tasks:\n\t- name: backup\n", "line 2: tabs can't be used for indentation"},
+		{"over indented key", "name: backup\n    interval: 1h\n", "line 2: unexpected indentation"},
+		{"over indented sequence item", "- a\n  - b\n", "line 2: unexpected indentation"},
+		{"unterminated double quote", "name: \"backup\n", "line 1: invalid double quoted string"},
+		{"unterminated single quote", "name: 'backup\n", "line 1: unterminated single quoted string"},
+		{"unterminated flow sequence", "tags: [a, b\n", "line 1: unterminated flow sequence"},
+		{"duplicate key", "name: a\nname: b\n", "the key \"name\" is defined more than once"},
+		{"nested plain mapping value", "a: b: c\n", "line 1: a plain value can't contain \": \""},
+		{"nested plain mapping value in a flow mapping", "env: {A: b: c}\n", "line 1: a plain value can't contain \": \""},
+	}
+	for _, test := range tests {
+		value, err := parseYAML(test.document)
+		if err == nil {
+			t.Errorf("%s: parseYAML = %#v, expected an error", test.name, value)
+			continue
+		}
+		if !strings.Contains(err.Error(), test.errorText) {
+			t.Errorf("%s: parseYAML failed with %q, expected it to contain %q", test.name, err, test.errorText)
+		}
+	}
+}